@@ -25,9 +25,24 @@ class ChartMuseum(common.CommandRunner):
         elif storage == 'google':
             cmd += '--storage-google-bucket="%s" --storage-google-prefix="%s" >> %s 2>&1' \
                    % (common.STORAGE_GOOGLE_BUCKET, common.STORAGE_GOOGLE_PREFIX, common.LOGFILE)
+        elif storage == 'microsoft':
+            cmd += '--storage-microsoft-container="%s" --storage-microsoft-prefix="%s" ' \
+                   % (common.STORAGE_MICROSOFT_CONTAINER, common.STORAGE_MICROSOFT_PREFIX)
+            if common.STORAGE_MICROSOFT_EMULATOR:
+                cmd += '--storage-microsoft-emulator >> %s 2>&1' % common.LOGFILE
+            else:
+                cmd += '--storage-microsoft-account="%s" --storage-microsoft-access-key="%s" >> %s 2>&1' \
+                       % (common.STORAGE_MICROSOFT_ACCOUNT, common.STORAGE_MICROSOFT_ACCESS_KEY, common.LOGFILE)
         print(cmd)
         self.run_command(cmd, detach=True)
 
+    def microsoft_storage_is_configured(self):
+        if not common.STORAGE_MICROSOFT_CONTAINER:
+            return False
+        if common.STORAGE_MICROSOFT_EMULATOR:
+            return True
+        return bool(common.STORAGE_MICROSOFT_ACCOUNT and common.STORAGE_MICROSOFT_ACCESS_KEY)
+
     def stop_chartmuseum(self):
         self.run_command('pkill -9 chartmuseum')
         shutil.rmtree(common.STORAGE_DIR, ignore_errors=True)
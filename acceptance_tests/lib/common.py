@@ -15,9 +15,14 @@ LOGFILE = '.chartmuseum.log'
 STORAGE_AMAZON_BUCKET = os.environ['TEST_STORAGE_AMAZON_BUCKET']
 STORAGE_AMAZON_REGION = os.environ['TEST_STORAGE_AMAZON_REGION']
 STORAGE_GOOGLE_BUCKET = os.environ['TEST_STORAGE_GOOGLE_BUCKET']
+STORAGE_MICROSOFT_CONTAINER = os.environ.get('TEST_STORAGE_MICROSOFT_CONTAINER', '')
+STORAGE_MICROSOFT_ACCOUNT = os.environ.get('TEST_STORAGE_MICROSOFT_ACCOUNT', '')
+STORAGE_MICROSOFT_ACCESS_KEY = os.environ.get('TEST_STORAGE_MICROSOFT_ACCESS_KEY', '')
+STORAGE_MICROSOFT_EMULATOR = os.environ.get('TEST_STORAGE_MICROSOFT_EMULATOR', '') == '1'
 
 STORAGE_AMAZON_PREFIX = 'acceptance/%s' % NOW
 STORAGE_GOOGLE_PREFIX = 'acceptance/%s' % NOW
+STORAGE_MICROSOFT_PREFIX = 'acceptance/%s' % NOW
 
 
 class CommandRunner(object):
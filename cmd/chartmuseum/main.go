@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/chartmuseum/chartmuseum/pkg/chartmuseum"
+	"github.com/chartmuseum/chartmuseum/pkg/mirror"
 	"github.com/chartmuseum/chartmuseum/pkg/storage"
 
 	"github.com/urfave/cli"
@@ -18,6 +19,7 @@ var (
 	exit  = os.Exit
 
 	newServer = chartmuseum.NewServer
+	newMirror = mirror.NewMirror
 
 	// Version is the semantic version (added at compile time)
 	Version string
@@ -30,9 +32,18 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "ChartMuseum"
 	app.Version = fmt.Sprintf("%s (build %s)", Version, Revision)
-	app.Usage = "Helm Chart Repository with support for Amazon S3 and Google Cloud Storage"
+	app.Usage = "Helm Chart Repository with support for Amazon S3, Google Cloud Storage and Microsoft Azure Blob Storage"
 	app.Action = cliHandler
 	app.Flags = cliFlags
+	app.Commands = []cli.Command{
+		{
+			Name:      "mirror",
+			Usage:     "download the chart packages and provenance files of a remote repository to storage",
+			ArgsUsage: "<repo-url>",
+			Action:    mirrorCliHandler,
+			Flags:     append(mirrorFlags, storageFlags...),
+		},
+	}
 	app.Run(os.Args)
 }
 
@@ -40,15 +51,30 @@ func cliHandler(c *cli.Context) {
 	backend := backendFromContext(c)
 
 	options := chartmuseum.ServerOptions{
-		Debug:          c.Bool("debug"),
-		LogJSON:        c.Bool("log-json"),
-		EnableAPI:      !c.Bool("disable-api"),
-		ChartURL:       c.String("chart-url"),
-		TlsCert:        c.String("tls-cert"),
-		TlsKey:         c.String("tls-key"),
-		Username:       c.String("basic-auth-user"),
-		Password:       c.String("basic-auth-pass"),
-		StorageBackend: backend,
+		Debug:                c.Bool("debug"),
+		LogJSON:              c.Bool("log-json"),
+		EnableAPI:            !c.Bool("disable-api"),
+		EnableMetrics:        c.Bool("enable-metrics"),
+		ChartURL:             c.String("chart-url"),
+		TlsCert:              c.String("tls-cert"),
+		TlsKey:               c.String("tls-key"),
+		Username:             c.String("basic-auth-user"),
+		Password:             c.String("basic-auth-pass"),
+		AuthTokenFile:        c.String("auth-token-file"),
+		AuthJWTPublicKey:     c.String("auth-jwt-public-key"),
+		AuthAnonymousGet:     c.Bool("auth-anonymous-get"),
+		PersistIndexCache:    c.Bool("persist-index-cache"),
+		IndexRefreshInterval: c.Duration("index-refresh-interval"),
+		AllowOverwrite:       c.Bool("allow-overwrite"),
+		Depth:                c.Int("depth"),
+		ProxyUpstreams:       c.StringSlice("proxy-upstream"),
+		LintOnUpload:         c.Bool("lint-on-upload"),
+		LintSeverity:         c.String("lint-severity"),
+		Keyring:              c.String("keyring"),
+		RequireProvenance:    c.Bool("require-provenance"),
+		SigningKeyring:       c.String("signing-keyring"),
+		SigningKey:           c.String("signing-key"),
+		StorageBackend:       backend,
 	}
 
 	server, err := newServer(options)
@@ -57,13 +83,55 @@ func cliHandler(c *cli.Context) {
 	}
 
 	if c.Bool("gen-index") {
-		echo(string(server.RepositoryIndex.Raw[:]))
+		if options.Depth > 0 {
+			crash("--gen-index is not supported with --depth")
+		}
+		echo(string(server.RepositoryIndex().Raw[:]))
 		exit(0)
 	}
 
 	server.Listen(c.Int("port"))
 }
 
+func mirrorCliHandler(c *cli.Context) {
+	if c.NArg() != 1 {
+		crash("Missing required argument: <repo-url>")
+	}
+	backend := backendFromContext(c)
+
+	options := mirror.Options{
+		RepositoryURL: c.Args().First(),
+		ChartName:     c.String("chart-name"),
+		ChartVersion:  c.String("chart-version"),
+		Parallelism:   c.Int("parallelism"),
+		DryRun:        c.Bool("dry-run"),
+	}
+
+	chartMirror, err := newMirror(backend, options)
+	if err != nil {
+		crash(err)
+	}
+
+	report, err := chartMirror.Run()
+	if err != nil {
+		crash(err)
+	}
+
+	for _, result := range report.Results {
+		switch {
+		case result.Err != nil:
+			echo(fmt.Sprintf("%s %s-%s: %s\n", result.Status, result.Name, result.Version, result.Err))
+		case result.Status != mirror.StatusUnchanged:
+			echo(fmt.Sprintf("%s %s\n", result.Status, result.Filename))
+		}
+	}
+	echo(fmt.Sprintf("%s\n", report.Summary()))
+
+	if report.Count(mirror.StatusFailed) > 0 {
+		exit(1)
+	}
+}
+
 func backendFromContext(c *cli.Context) storage.Backend {
 	crashIfContextMissingFlags(c, []string{"storage"})
 
@@ -77,6 +145,8 @@ func backendFromContext(c *cli.Context) storage.Backend {
 		backend = amazonBackendFromContext(c)
 	case "google":
 		backend = googleBackendFromContext(c)
+	case "microsoft":
+		backend = microsoftBackendFromContext(c)
 	default:
 		crash("Unsupported storage backend: ", storageFlag)
 	}
@@ -93,10 +163,17 @@ func localBackendFromContext(c *cli.Context) storage.Backend {
 
 func amazonBackendFromContext(c *cli.Context) storage.Backend {
 	crashIfContextMissingFlags(c, []string{"storage-amazon-bucket", "storage-amazon-region"})
-	return storage.Backend(storage.NewAmazonS3Backend(
+	return storage.Backend(storage.NewAmazonS3BackendWithOptions(
 		c.String("storage-amazon-bucket"),
 		c.String("storage-amazon-prefix"),
 		c.String("storage-amazon-region"),
+		storage.AmazonS3Options{
+			Endpoint:        c.String("storage-amazon-endpoint"),
+			ForcePathStyle:  c.Bool("storage-amazon-force-path-style"),
+			DisableSSL:      c.Bool("storage-amazon-disable-ssl"),
+			AccessKeyID:     c.String("storage-amazon-access-key-id"),
+			SecretAccessKey: c.String("storage-amazon-secret-access-key"),
+		},
 	))
 }
 
@@ -108,6 +185,23 @@ func googleBackendFromContext(c *cli.Context) storage.Backend {
 	))
 }
 
+func microsoftBackendFromContext(c *cli.Context) storage.Backend {
+	crashIfContextMissingFlags(c, []string{"storage-microsoft-container"})
+	if c.Bool("storage-microsoft-emulator") {
+		return storage.Backend(storage.NewMicrosoftBlobEmulatorBackend(
+			c.String("storage-microsoft-container"),
+			c.String("storage-microsoft-prefix"),
+		))
+	}
+	crashIfContextMissingFlags(c, []string{"storage-microsoft-account", "storage-microsoft-access-key"})
+	return storage.Backend(storage.NewMicrosoftBlobBackend(
+		c.String("storage-microsoft-account"),
+		c.String("storage-microsoft-access-key"),
+		c.String("storage-microsoft-container"),
+		c.String("storage-microsoft-prefix"),
+	))
+}
+
 func crashIfContextMissingFlags(c *cli.Context, flags []string) {
 	missing := []string{}
 	for _, flag := range flags {
@@ -120,7 +214,9 @@ func crashIfContextMissingFlags(c *cli.Context, flags []string) {
 	}
 }
 
-var cliFlags = []cli.Flag{
+var cliFlags = append(serverFlags, storageFlags...)
+
+var serverFlags = []cli.Flag{
 	cli.BoolFlag{
 		Name:   "gen-index",
 		Usage:  "generate index.yaml, print to stdout and exit",
@@ -141,12 +237,74 @@ var cliFlags = []cli.Flag{
 		Usage:  "disable all routes prefixed with /api",
 		EnvVar: "DISABLE_API",
 	},
+	cli.BoolFlag{
+		Name:   "enable-metrics",
+		Usage:  "expose prometheus metrics at /metrics",
+		EnvVar: "ENABLE_METRICS",
+	},
+	cli.BoolFlag{
+		Name:   "persist-index-cache",
+		Usage:  "save generated index to storage and load it at startup, only fetching charts changed since",
+		EnvVar: "PERSIST_INDEX_CACHE",
+	},
+	cli.DurationFlag{
+		Name:   "index-refresh-interval",
+		Usage:  "refresh index from storage in the background at this interval (e.g. 30s), instead of on every request",
+		EnvVar: "INDEX_REFRESH_INTERVAL",
+	},
+	cli.BoolFlag{
+		Name:   "allow-overwrite",
+		Usage:  "allow uploads to replace an existing chart version when the ?force query parameter is given",
+		EnvVar: "ALLOW_OVERWRITE",
+	},
+	cli.BoolFlag{
+		Name:   "lint-on-upload",
+		Usage:  "run helm lint rules on uploaded chart packages, rejecting those with messages at or above --lint-severity",
+		EnvVar: "LINT_ON_UPLOAD",
+	},
+	cli.StringFlag{
+		Name:   "lint-severity",
+		Value:  "error",
+		Usage:  "lowest lint message severity rejecting an upload with --lint-on-upload, can be one of: info, warning, error",
+		EnvVar: "LINT_SEVERITY",
+	},
+	cli.StringFlag{
+		Name:   "keyring",
+		Usage:  "path to a keyring of trusted public keys, verifying uploaded provenance files against it and their chart package",
+		EnvVar: "KEYRING",
+	},
+	cli.BoolFlag{
+		Name:   "require-provenance",
+		Usage:  "only publish chart versions whose provenance file is verified against --keyring",
+		EnvVar: "REQUIRE_PROVENANCE",
+	},
+	cli.StringFlag{
+		Name:   "signing-keyring",
+		Usage:  "path to a secret keyring holding --signing-key, generating the missing provenance files of uploaded chart packages",
+		EnvVar: "SIGNING_KEYRING",
+	},
+	cli.StringFlag{
+		Name:   "signing-key",
+		Usage:  "name of the key in --signing-keyring signing uploaded chart packages (e.g. an email address)",
+		EnvVar: "SIGNING_KEY",
+	},
 	cli.IntFlag{
 		Name:   "port",
 		Value:  8080,
 		Usage:  "port to listen on",
 		EnvVar: "PORT",
 	},
+	cli.IntFlag{
+		Name:   "depth",
+		Value:  0,
+		Usage:  "levels of nested repositories in urls and storage (e.g. 2 for /<org>/<repo>/index.yaml)",
+		EnvVar: "DEPTH",
+	},
+	cli.StringSliceFlag{
+		Name:   "proxy-upstream",
+		Usage:  "url of an upstream chart repository whose charts are merged into the index and pulled on demand (may be repeated)",
+		EnvVar: "PROXY_UPSTREAM",
+	},
 	cli.StringFlag{
 		Name:   "chart-url",
 		Usage:  "absolute url for .tgzs in index.yaml",
@@ -162,6 +320,21 @@ var cliFlags = []cli.Flag{
 		Usage:  "password for basic http authentication",
 		EnvVar: "BASIC_AUTH_PASS",
 	},
+	cli.StringFlag{
+		Name:   "auth-token-file",
+		Usage:  "path to a yaml file of bearer tokens and the scopes (pull, push, delete) they grant",
+		EnvVar: "AUTH_TOKEN_FILE",
+	},
+	cli.StringFlag{
+		Name:   "auth-jwt-public-key",
+		Usage:  "path to a pem-encoded rsa public key verifying bearer JWTs and their scope claims",
+		EnvVar: "AUTH_JWT_PUBLIC_KEY",
+	},
+	cli.BoolFlag{
+		Name:   "auth-anonymous-get",
+		Usage:  "allow GET requests for the index, chart packages and chart API without credentials",
+		EnvVar: "AUTH_ANONYMOUS_GET",
+	},
 	cli.StringFlag{
 		Name:   "tls-cert",
 		Usage:  "path to tls certificate chain file",
@@ -172,9 +345,32 @@ var cliFlags = []cli.Flag{
 		Usage:  "path to tls key file",
 		EnvVar: "TLS_KEY",
 	},
+}
+
+var mirrorFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "chart-name",
+		Usage: "only mirror charts whose name matches this regular expression",
+	},
+	cli.StringFlag{
+		Name:  "chart-version",
+		Usage: "only mirror chart versions matching this semver constraint (e.g. \">=1.0.0, <2.0.0\")",
+	},
+	cli.IntFlag{
+		Name:  "parallelism",
+		Value: mirror.DefaultParallelism,
+		Usage: "number of chart versions downloaded at the same time",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "only report the chart versions that would be downloaded",
+	},
+}
+
+var storageFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:   "storage",
-		Usage:  "storage backend, can be one of: local, amazon, google",
+		Usage:  "storage backend, can be one of: local, amazon, google, microsoft",
 		EnvVar: "STORAGE",
 	},
 	cli.StringFlag{
@@ -197,6 +393,31 @@ var cliFlags = []cli.Flag{
 		Usage:  "region of --storage-amazon-bucket",
 		EnvVar: "STORAGE_AMAZON_REGION",
 	},
+	cli.StringFlag{
+		Name:   "storage-amazon-endpoint",
+		Usage:  "alternative s3 endpoint url (e.g. minio, ceph rgw) for --storage-amazon-bucket",
+		EnvVar: "STORAGE_AMAZON_ENDPOINT",
+	},
+	cli.BoolFlag{
+		Name:   "storage-amazon-force-path-style",
+		Usage:  "use path-style addressing (<endpoint>/<bucket>) instead of virtual hosted-style",
+		EnvVar: "STORAGE_AMAZON_FORCE_PATH_STYLE",
+	},
+	cli.BoolFlag{
+		Name:   "storage-amazon-disable-ssl",
+		Usage:  "use http instead of https for --storage-amazon-endpoint",
+		EnvVar: "STORAGE_AMAZON_DISABLE_SSL",
+	},
+	cli.StringFlag{
+		Name:   "storage-amazon-access-key-id",
+		Usage:  "static access key id for amazon storage backend (default credential chain used if not set)",
+		EnvVar: "STORAGE_AMAZON_ACCESS_KEY_ID",
+	},
+	cli.StringFlag{
+		Name:   "storage-amazon-secret-access-key",
+		Usage:  "static secret access key for --storage-amazon-access-key-id",
+		EnvVar: "STORAGE_AMAZON_SECRET_ACCESS_KEY",
+	},
 	cli.StringFlag{
 		Name:   "storage-google-bucket",
 		Usage:  "gcs bucket to store charts for google storage backend",
@@ -207,4 +428,29 @@ var cliFlags = []cli.Flag{
 		Usage:  "prefix to store charts for --storage-google-bucket",
 		EnvVar: "STORAGE_GOOGLE_PREFIX",
 	},
+	cli.StringFlag{
+		Name:   "storage-microsoft-container",
+		Usage:  "container to store charts for microsoft storage backend",
+		EnvVar: "STORAGE_MICROSOFT_CONTAINER",
+	},
+	cli.StringFlag{
+		Name:   "storage-microsoft-prefix",
+		Usage:  "prefix to store charts for --storage-microsoft-container",
+		EnvVar: "STORAGE_MICROSOFT_PREFIX",
+	},
+	cli.StringFlag{
+		Name:   "storage-microsoft-account",
+		Usage:  "storage account name of --storage-microsoft-container",
+		EnvVar: "STORAGE_MICROSOFT_ACCOUNT,AZURE_STORAGE_ACCOUNT",
+	},
+	cli.StringFlag{
+		Name:   "storage-microsoft-access-key",
+		Usage:  "access key for --storage-microsoft-account",
+		EnvVar: "STORAGE_MICROSOFT_ACCESS_KEY,AZURE_STORAGE_ACCESS_KEY",
+	},
+	cli.BoolFlag{
+		Name:   "storage-microsoft-emulator",
+		Usage:  "use the local storage emulator (e.g. Azurite) instead of --storage-microsoft-account",
+		EnvVar: "STORAGE_MICROSOFT_EMULATOR",
+	},
 }
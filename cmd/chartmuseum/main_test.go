@@ -7,7 +7,6 @@ import (
 	"testing"
 
 	"github.com/chartmuseum/chartmuseum/pkg/chartmuseum"
-	"github.com/chartmuseum/chartmuseum/pkg/repo"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -55,22 +54,48 @@ func (suite *MainTestSuite) TestMain() {
 	suite.Panics(main, "amazon storage")
 	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with amazon backend")
 
+	os.Args = []string{"chartmuseum", "--storage", "amazon", "--storage-amazon-bucket", "x", "--storage-amazon-region", "x",
+		"--storage-amazon-endpoint", "http://localhost:9000", "--storage-amazon-force-path-style",
+		"--storage-amazon-access-key-id", "x", "--storage-amazon-secret-access-key", "x"}
+	suite.Panics(main, "amazon storage, s3-compatible endpoint")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with amazon backend, s3-compatible endpoint")
+
 	os.Args = []string{"chartmuseum", "--storage", "google", "--storage-google-bucket", "x"}
 	suite.Panics(main, "google storage")
 	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with google backend")
 
+	os.Args = []string{"chartmuseum", "--storage", "microsoft", "--storage-microsoft-container", "x", "--storage-microsoft-emulator"}
+	suite.Panics(main, "microsoft storage")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with microsoft backend")
+
 	// test the --gen-index option
-	newServer = func(options chartmuseum.ServerOptions) (*chartmuseum.Server, error) {
-		s := &chartmuseum.Server{}
-		s.RepositoryIndex = repo.NewIndex("")
-		s.RepositoryIndex.Regenerate()
-		return s, nil
-	}
-	os.Args = []string{"chartmuseum", "--gen-index", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	genIndexDirectory := "../../.test/chartmuseum-gen-index"
+	defer os.RemoveAll(genIndexDirectory)
+	newServer = chartmuseum.NewServer
+	os.Args = []string{"chartmuseum", "--gen-index", "--storage", "local", "--storage-local-rootdir", genIndexDirectory}
 	suite.Panics(main, "exited 0")
 	suite.Equal("exited 0", suite.LastCrashMessage, "no error with --gen-index")
 	suite.Equal(0, suite.LastExitCode, "--gen-index flag exits 0")
 	suite.Contains(suite.LastPrinted, "apiVersion:", "--gen-index prints yaml")
+
+	os.Args = []string{"chartmuseum", "--gen-index", "--depth", "2", "--storage", "local", "--storage-local-rootdir", genIndexDirectory}
+	suite.Panics(main, "--gen-index with --depth")
+	suite.Equal("--gen-index is not supported with --depth", suite.LastCrashMessage, "crashes with --gen-index and --depth")
+}
+
+func (suite *MainTestSuite) TestMirror() {
+	os.Args = []string{"chartmuseum", "mirror", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	suite.Panics(main, "mirror without repository url")
+	suite.Equal("Missing required argument: <repo-url>", suite.LastCrashMessage, "crashes with no repository url")
+
+	os.Args = []string{"chartmuseum", "mirror", "https://kubernetes-charts.storage.googleapis.com"}
+	suite.Panics(main, "mirror without storage")
+	suite.Equal("Missing required flags(s): --storage", suite.LastCrashMessage, "crashes with no storage")
+
+	os.Args = []string{"chartmuseum", "mirror", "--chart-version", "not a constraint",
+		"--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "https://kubernetes-charts.storage.googleapis.com"}
+	suite.Panics(main, "mirror with invalid chart version constraint")
+	suite.Contains(suite.LastCrashMessage, "invalid chart version constraint", "crashes with invalid chart version constraint")
 }
 
 func TestMainTestSuite(t *testing.T) {
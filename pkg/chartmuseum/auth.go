@@ -0,0 +1,203 @@
+package chartmuseum
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ghodss/yaml"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ScopePull allows downloading charts and reading the index and api
+	ScopePull = "pull"
+
+	// ScopePush allows uploading chart packages and provenance files
+	ScopePush = "push"
+
+	// ScopeDelete allows deleting chart versions
+	ScopeDelete = "delete"
+)
+
+var (
+	// allScopes are the scopes granted to the basic auth user
+	allScopes = []string{ScopePull, ScopePush, ScopeDelete}
+
+	authRealm = "ChartMuseum"
+
+	errorUnauthorized      = errors.New("missing or invalid credentials")
+	errorInsufficientScope = errors.New("credentials do not grant access to this route")
+)
+
+type (
+	// authenticator checks the credentials of requests: basic auth, static bearer tokens or JWTs
+	authenticator struct {
+		users        map[string]string
+		tokens       []staticToken
+		jwtKey       *rsa.PublicKey
+		anonymousGet bool
+	}
+
+	// staticToken is a bearer token from the token file, and the scopes it grants
+	staticToken struct {
+		Name   string   `json:"name"`
+		Token  string   `json:"token"`
+		Scopes []string `json:"scopes"`
+	}
+)
+
+// enableTokenAuth adds bearer token authentication to the router, with static tokens from a file
+// and/or JWTs signed with the private key matching a public key file
+func (router *Router) enableTokenAuth(tokenFile string, jwtPublicKeyFile string) error {
+	if router.auth == nil {
+		router.auth = &authenticator{users: map[string]string{}}
+	}
+	if tokenFile != "" {
+		tokens, err := loadStaticTokens(tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to load token file: %s", err)
+		}
+		router.auth.tokens = tokens
+	}
+	if jwtPublicKeyFile != "" {
+		content, err := ioutil.ReadFile(jwtPublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load jwt public key: %s", err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(content)
+		if err != nil {
+			return fmt.Errorf("failed to load jwt public key: %s", err)
+		}
+		router.auth.jwtKey = key
+	}
+	return nil
+}
+
+// loadStaticTokens reads a yaml list of tokens, each with a name and the scopes it grants
+func loadStaticTokens(filename string) ([]staticToken, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []staticToken{}
+	err = yaml.Unmarshal(content, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if token.Token == "" {
+			return nil, fmt.Errorf("token %q is empty", token.Name)
+		}
+		for _, scope := range token.Scopes {
+			if !containsScope(allScopes, scope) {
+				return nil, fmt.Errorf("token %q has unknown scope %q", token.Name, scope)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// middleware rejects requests without credentials granting a scope,
+// except requests to public routes without credentials if anonymous GET is allowed
+func (auth *authenticator) middleware(scope string, public bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if public && auth.anonymousGet && c.Request.Header.Get("Authorization") == "" {
+			return
+		}
+		scopes, err := auth.authenticate(c.Request)
+		if err != nil {
+			for _, challenge := range auth.challenges() {
+				c.Writer.Header().Add("WWW-Authenticate", challenge)
+			}
+			errorResponse(c, err)
+			c.Abort()
+			return
+		}
+		if !containsScope(scopes, scope) {
+			errorResponse(c, errorInsufficientScope)
+			c.Abort()
+			return
+		}
+	}
+}
+
+// authenticate returns the scopes granted by the credentials of a request
+func (auth *authenticator) authenticate(request *http.Request) ([]string, error) {
+	header := request.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(header, "Basic "):
+		username, password, ok := request.BasicAuth()
+		expected, found := auth.users[username]
+		if ok && found && subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1 {
+			return allScopes, nil
+		}
+	case strings.HasPrefix(header, "Bearer "):
+		value := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+		for _, token := range auth.tokens {
+			if subtle.ConstantTimeCompare([]byte(value), []byte(token.Token)) == 1 {
+				return token.Scopes, nil
+			}
+		}
+		if auth.jwtKey != nil {
+			return auth.jwtScopes(value)
+		}
+	}
+	return nil, errorUnauthorized
+}
+
+// jwtScopes verifies a JWT (signature, expiry) and returns the scopes in its "scope" claim,
+// a space-separated string as in OAuth 2.0, or its "scopes" claim, a list
+func (auth *authenticator) jwtScopes(value string) ([]string, error) {
+	token, err := jwt.Parse(value, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return auth.jwtKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errorUnauthorized
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errorUnauthorized
+	}
+	scopes := []string{}
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	if list, ok := claims["scopes"].([]interface{}); ok {
+		for _, scope := range list {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes, nil
+}
+
+// challenges returns the WWW-Authenticate headers of the supported authentication schemes
+func (auth *authenticator) challenges() []string {
+	challenges := []string{}
+	if len(auth.users) > 0 {
+		challenges = append(challenges, fmt.Sprintf("Basic realm=%q", authRealm))
+	}
+	if len(auth.tokens) > 0 || auth.jwtKey != nil {
+		challenges = append(challenges, fmt.Sprintf("Bearer realm=%q", authRealm))
+	}
+	return challenges
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
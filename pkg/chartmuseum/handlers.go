@@ -1,53 +1,135 @@
 package chartmuseum
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathutil "path"
+	"strconv"
 	"strings"
 
 	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
 
 	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
 )
 
 var (
-	objectSavedResponse        = gin.H{"saved": true}
-	objectDeletedResponse      = gin.H{"deleted": true}
-	notFoundErrorResponse      = gin.H{"error": "not found"}
-	badExtensionErrorResponse  = gin.H{"error": "unsupported file extension"}
-	alreadyExistsErrorResponse = gin.H{"error": "file already exists"}
+	objectSavedResponse   = gin.H{"saved": true}
+	objectDeletedResponse = gin.H{"deleted": true}
+	healthyResponse       = gin.H{"healthy": true}
+	readyResponse         = gin.H{"ready": true}
+
+	errorUnsupportedFileExtension = errors.New("unsupported file extension")
 )
 
+func (server *Server) getHealthRequestHandler(c *gin.Context) {
+	c.JSON(200, healthyResponse)
+}
+
+func (server *Server) getReadyRequestHandler(c *gin.Context) {
+	err := server.checkReady()
+	if err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": "not_ready"})
+		return
+	}
+	c.JSON(200, readyResponse)
+}
+
 func (server *Server) getIndexFileRequestHandler(c *gin.Context) {
 	err := server.syncRepositoryIndex()
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
-	c.Data(200, repo.IndexFileContentType, server.RepositoryIndex.Raw)
+	c.Data(200, repo.IndexFileContentType, server.servedRepositoryIndex().Raw)
 }
 
 func (server *Server) getAllChartsRequestHandler(c *gin.Context) {
-	err := server.syncRepositoryIndex()
+	offset, limit, err := paginationFromRequest(c)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
-	c.JSON(200, server.RepositoryIndex.Entries)
+	sortBy, descending, err := sortFromRequest(c, "name")
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	err = server.syncRepositoryIndex()
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	index := server.servedRepositoryIndex()
+
+	// charts are sorted by their latest version
+	latestChartVersions := []*helm_repo.ChartVersion{}
+	for _, chartVersions := range index.Entries {
+		if len(chartVersions) > 0 {
+			latestChartVersions = append(latestChartVersions, chartVersions[0])
+		}
+	}
+	latestChartVersions = sortChartVersions(latestChartVersions, sortBy, descending)
+
+	fields := fieldsFromRequest(c)
+	response := chartsResponse{names: []string{}, charts: map[string]interface{}{}}
+	for _, chartVersion := range paginate(latestChartVersions, offset, limit) {
+		chart, err := selectFields(index.Entries[chartVersion.Name], fields)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+		response.names = append(response.names, chartVersion.Name)
+		response.charts[chartVersion.Name] = chart
+	}
+	c.Header(totalCountHeader, strconv.Itoa(len(latestChartVersions)))
+	c.JSON(200, response)
 }
 
 func (server *Server) getChartRequestHandler(c *gin.Context) {
 	name := c.Param("name")
-	err := server.syncRepositoryIndex()
+	offset, limit, err := paginationFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	sortBy, descending, err := sortFromRequest(c, "version")
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
-	chart := server.RepositoryIndex.Entries[name]
+	err = server.syncRepositoryIndex()
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	if constraint, ok := c.GetQuery("version"); ok {
+		_, prerelease := c.GetQuery("prerelease")
+		chartVersion, err := server.servedRepositoryIndex().GetMatching(name, constraint, prerelease)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+		c.JSON(200, chartVersion)
+		return
+	}
+	chart := server.servedRepositoryIndex().Entries[name]
 	if chart == nil {
-		c.JSON(404, notFoundErrorResponse)
+		errorResponse(c, repo.ErrorChartNotFound)
+		return
+	}
+	chartVersions := sortChartVersions(chart, sortBy, descending)
+	response, err := selectFields(paginate(chartVersions, offset, limit), fieldsFromRequest(c))
+	if err != nil {
+		errorResponse(c, err)
 		return
 	}
-	c.JSON(200, chart)
+	c.Header(totalCountHeader, strconv.Itoa(len(chartVersions)))
+	c.JSON(200, response)
 }
 
 func (server *Server) getChartVersionRequestHandler(c *gin.Context) {
@@ -58,17 +140,39 @@ func (server *Server) getChartVersionRequestHandler(c *gin.Context) {
 	}
 	err := server.syncRepositoryIndex()
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
-	chartVersion, err := server.RepositoryIndex.Get(name, version)
+	chartVersion, err := server.servedRepositoryIndex().Get(name, version)
 	if err != nil {
-		c.JSON(404, notFoundErrorResponse)
+		errorResponse(c, repo.ErrorChartNotFound)
 		return
 	}
 	c.JSON(200, chartVersion)
 }
 
+func (server *Server) getSearchRequestHandler(c *gin.Context) {
+	offset, limit, err := paginationFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	_, latest := c.GetQuery("latest")
+	err = server.syncRepositoryIndex()
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	results := server.servedRepositoryIndex().Search(c.Query("q"), latest)
+	response, err := selectFields(paginate(results, offset, limit), fieldsFromRequest(c))
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	c.Header(totalCountHeader, strconv.Itoa(len(results)))
+	c.JSON(200, response)
+}
+
 func (server *Server) deleteChartVersionRequestHandler(c *gin.Context) {
 	name := c.Param("name")
 	version := c.Param("version")
@@ -78,11 +182,15 @@ func (server *Server) deleteChartVersionRequestHandler(c *gin.Context) {
 	)
 	err := server.StorageBackend.DeleteObject(filename)
 	if err != nil {
-		c.JSON(404, notFoundErrorResponse)
+		errorResponse(c, err)
 		return
 	}
 	provFilename := repo.ProvenanceFilenameFromNameVersion(name, version)
 	server.StorageBackend.DeleteObject(provFilename) // ignore error here, may be no prov file
+	err = server.removeChartFromIndex(name, version)
+	if err != nil {
+		server.indexUpdateFailed(filename, err)
+	}
 	c.JSON(200, objectDeletedResponse)
 }
 
@@ -91,76 +199,363 @@ func (server *Server) getStorageObjectRequestHandler(c *gin.Context) {
 	isChartPackage := strings.HasSuffix(filename, repo.ChartPackageFileExtension)
 	isProvenanceFile := strings.HasSuffix(filename, repo.ProvenanceFileExtension)
 	if !isChartPackage && !isProvenanceFile {
-		c.JSON(500, badExtensionErrorResponse)
+		errorResponse(c, errorUnsupportedFileExtension)
+		return
+	}
+	contentType := repo.ChartPackageContentType
+	if isProvenanceFile {
+		contentType = repo.ProvenanceFileContentType
+	}
+	if backend, ok := server.StorageBackend.(storage.StreamingBackend); ok {
+		server.streamStorageObject(c, backend, filename, contentType)
 		return
 	}
 	object, err := server.StorageBackend.GetObject(filename)
+	if err == storage.ErrorObjectNotFound && server.proxy != nil {
+		server.serveUpstreamObject(c, filename, contentType)
+		return
+	}
 	if err != nil {
-		c.JSON(404, notFoundErrorResponse)
+		errorResponse(c, err)
 		return
 	}
-	if isProvenanceFile {
-		c.Data(200, repo.ProvenanceFileContentType, object.Content)
+	server.Metrics.addDownloadBytes(int64(len(object.Content)))
+	c.Data(200, contentType, object.Content)
+}
+
+func (server *Server) streamStorageObject(c *gin.Context, backend storage.StreamingBackend, filename string, contentType string) {
+	stream, err := backend.GetObjectStream(filename)
+	if err == storage.ErrorObjectNotFound && server.proxy != nil {
+		server.serveUpstreamObject(c, filename, contentType)
 		return
 	}
-	c.Data(200, repo.ChartPackageContentType, object.Content)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	defer stream.Close()
+	c.Header("Content-Type", contentType)
+	if stream.Size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(stream.Size, 10))
+	}
+	c.Status(200)
+	n, err := io.Copy(c.Writer, stream)
+	server.Metrics.addDownloadBytes(n)
+	if err != nil {
+		// headers have already been sent, so all we can do is log
+		server.Logger.Errorw("Error streaming object from storage",
+			"object", filename,
+			"error", err.Error(),
+		)
+	}
+}
+
+// serveUpstreamObject responds with a file missing from storage, pulled from an upstream repository
+func (server *Server) serveUpstreamObject(c *gin.Context, filename string, contentType string) {
+	content, err := server.pullFromUpstream(filename)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	server.Metrics.addDownloadBytes(int64(len(content)))
+	c.Data(200, contentType, content)
 }
 
 func (server *Server) postPackageRequestHandler(c *gin.Context) {
-	content, err := c.GetRawData()
+	if strings.HasPrefix(c.ContentType(), multipartContentType) {
+		server.postMultipartUploadRequestHandler(c)
+		return
+	}
+	// the package is spooled to disk, so it is validated, linted, signed and saved without being held in memory
+	tempDirectory, err := ioutil.TempDir("", "chartmuseum-upload")
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
-	filename, err := repo.ChartPackageFilenameFromContent(content)
+	defer os.RemoveAll(tempDirectory)
+	spoolPath := pathutil.Join(tempDirectory, "upload")
+	size, err := spoolRequestBody(c, spoolPath)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
-	_, err = server.StorageBackend.GetObject(filename)
-	if err == nil {
-		c.JSON(500, alreadyExistsErrorResponse)
+	chartVersion, err := server.validateChartPackageFile(spoolPath)
+	if err != nil {
+		errorResponse(c, err)
 		return
 	}
+	filename := repo.ChartPackageFilenameFromNameVersion(chartVersion.Name, chartVersion.Version)
+	overwrite := server.overwriteRequested(c)
+	exists, err := server.storageObjectExists(filename)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	if exists {
+		if !overwrite {
+			errorResponse(c, storage.ErrorObjectAlreadyExists)
+			return
+		}
+		// the provenance file of the previous package no longer matches
+		provFilename := repo.ProvenanceFilenameFromChartPackageFilename(filename)
+		server.StorageBackend.DeleteObject(provFilename) // ignore error here, may be no prov file
+	}
+	// helm names the signed file in the provenance file after the file on disk
+	packagePath := pathutil.Join(tempDirectory, pathutil.Base(filename))
+	err = os.Rename(spoolPath, packagePath)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	var provContent []byte
+	if server.ProvenanceSigner != nil {
+		provContent, err = server.signChartPackage(filename, packagePath, chartVersion.Digest)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+	}
 	server.Logger.Debugw("Adding package to storage",
 		"package", filename,
+		"overwrite", overwrite,
 	)
-	err = server.StorageBackend.PutObject(filename, content)
+	err = server.putStorageObjectFile(filename, packagePath)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
+	server.Metrics.addUploadBytes(int(size))
+	if provContent != nil {
+		provFilename := repo.ProvenanceFilenameFromChartPackageFilename(filename)
+		server.Logger.Debugw("Adding generated provenance file to storage",
+			"provenance_file", provFilename,
+		)
+		err = server.StorageBackend.PutObject(provFilename, provContent)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+	}
+	if server.RequireProvenance && provContent == nil {
+		// the chart version is only published once its provenance file is uploaded
+		if exists {
+			err = server.removeChartFromIndex(chartVersion.Name, chartVersion.Version)
+		}
+	} else {
+		err = server.addChartVersionToIndex(filename, chartVersion)
+	}
+	if err != nil {
+		server.indexUpdateFailed(filename, err)
+	}
 	c.JSON(201, objectSavedResponse)
 }
 
 func (server *Server) postProvenanceFileRequestHandler(c *gin.Context) {
 	content, err := c.GetRawData()
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
 	filename, err := repo.ProvenanceFilenameFromContent(content)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
-	_, err = server.StorageBackend.GetObject(filename)
-	if err == nil {
-		c.JSON(500, alreadyExistsErrorResponse)
+	overwrite := server.overwriteRequested(c)
+	exists, err := server.storageObjectExists(filename)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	if exists && !overwrite {
+		errorResponse(c, storage.ErrorObjectAlreadyExists)
 		return
 	}
+	var packageObject storage.Object
+	if server.ProvenanceVerifier != nil {
+		packageObject, err = server.verifyProvenanceFile(filename, content)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+	}
 	server.Logger.Debugw("Adding provenance file to storage",
 		"provenance_file", filename,
+		"overwrite", overwrite,
 	)
 	err = server.StorageBackend.PutObject(filename, content)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		errorResponse(c, err)
 		return
 	}
+	server.Metrics.addUploadBytes(len(content))
+	// provenance files are served straight from storage and are not part of the index,
+	// but they publish their chart version when signed charts are required
+	if server.RequireProvenance {
+		packageFilename := repo.ChartPackageFilenameFromProvenanceFilename(filename)
+		err = server.addChartToIndex(packageFilename, packageObject.Content)
+		if err != nil {
+			server.indexUpdateFailed(packageFilename, err)
+		}
+	}
 	c.JSON(201, objectSavedResponse)
 }
 
-func errorResponse(err error) map[string]interface{} {
-	errResp := gin.H{"error": fmt.Sprintf("%s", err)}
-	return errResp
+// validateChartPackage returns the filename of an uploaded chart package, checking it passes linting if enabled
+func (server *Server) validateChartPackage(content []byte) (string, error) {
+	filename, err := repo.ChartPackageFilenameFromContent(content)
+	if err != nil {
+		return "", err
+	}
+	if server.LintOnUpload {
+		err = repo.LintChartPackage(content, server.LintSeverity)
+		if err != nil {
+			return "", err
+		}
+	}
+	return filename, nil
+}
+
+// validateChartPackageFile returns the chart version of a chart package on disk, checking it passes linting if enabled
+func (server *Server) validateChartPackageFile(path string) (*helm_repo.ChartVersion, error) {
+	chartVersion, err := repo.ChartVersionFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if server.LintOnUpload {
+		err = repo.LintChartPackageFile(path, server.LintSeverity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chartVersion, nil
+}
+
+// verifyProvenanceFile verifies the signature of a provenance file against the trusted keyring,
+// and that it matches the chart package already in storage, which is returned
+func (server *Server) verifyProvenanceFile(filename string, content []byte) (storage.Object, error) {
+	packageFilename := repo.ChartPackageFilenameFromProvenanceFilename(filename)
+	object, err := server.StorageBackend.GetObject(packageFilename)
+	if err == storage.ErrorObjectNotFound {
+		err = &repo.ProvenanceVerificationError{Err: fmt.Errorf("chart package %s must be uploaded first", packageFilename)}
+	}
+	if err != nil {
+		return object, err
+	}
+	err = repo.VerifyProvenanceFile(server.ProvenanceVerifier, content, packageFilename, object.Content)
+	return object, err
+}
+
+// overwriteRequested returns true if an existing file may be replaced, which requires both
+// the server option and the ?force query parameter
+func (server *Server) overwriteRequested(c *gin.Context) bool {
+	_, force := c.GetQuery("force")
+	return server.AllowOverwrite && force
+}
+
+// indexUpdateFailed falls back to a full refresh when a change could not be applied to the index directly
+func (server *Server) indexUpdateFailed(filename string, err error) {
+	server.Logger.Warnw("Unable to update index, falling back to full refresh",
+		"object", filename,
+		"error", err.Error(),
+	)
+	server.requestIndexRefresh()
+}
+
+// putStorageObjectFile saves a file to storage, streaming it if the backend can
+func (server *Server) putStorageObjectFile(filename string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if backend, ok := server.StorageBackend.(storage.StreamingBackend); ok {
+		return backend.PutObjectStream(filename, file)
+	}
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	return server.StorageBackend.PutObject(filename, content)
+}
+
+// spoolRequestBody writes the body of a request to a file, returning its size
+func spoolRequestBody(c *gin.Context, path string) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(file, c.Request.Body)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return size, err
+}
+
+// storageObjectExists determines whether or not an object exists in storage,
+// distinguishing a missing object from a storage backend failure
+func (server *Server) storageObjectExists(filename string) (bool, error) {
+	_, err := server.StorageBackend.GetObject(filename)
+	if err == storage.ErrorObjectNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// errorResponse responds with the http status code matching the error, and a json body
+// containing the error message and a machine-readable error code (and the messages of a lint error)
+func errorResponse(c *gin.Context, err error) {
+	status, code := errorStatusCode(err)
+	body := gin.H{"error": err.Error(), "code": code}
+	if lintError, ok := err.(*repo.LintError); ok {
+		body["messages"] = lintError.Messages
+	}
+	c.JSON(status, body)
+}
+
+func errorStatusCode(err error) (int, string) {
+	switch err {
+	case errorUnauthorized:
+		return 401, "unauthorized"
+	case errorInsufficientScope:
+		return 403, "forbidden"
+	case storage.ErrorObjectNotFound, repo.ErrorChartNotFound, repo.ErrorRemoteFileNotFound, errorFileNotFoundInChart, errorRepositoryNotFound:
+		return 404, "not_found"
+	case storage.ErrorObjectAlreadyExists:
+		return 409, "already_exists"
+	case repo.ErrorInvalidChartPackage:
+		return 400, "invalid_package"
+	case errorUnsupportedFileExtension:
+		return 400, "unsupported_extension"
+	case errorInvalidRepositoryName:
+		return 400, "invalid_repository"
+	case errorInvalidPagination, errorInvalidSort, errorInvalidFormat, repo.ErrorInvalidVersionConstraint:
+		return 400, "invalid_parameter"
+	case errorInvalidRenderRequest, errorInvalidMultipartUpload:
+		return 400, "invalid_request"
+	case repo.ErrorInvalidProvenanceFile:
+		return 422, "invalid_provenance"
+	case errorProvenanceMismatch:
+		return 422, "verification_failed"
+	}
+	if repo.IsProvenanceVerificationError(err) {
+		return 422, "verification_failed"
+	}
+	if repo.IsLintError(err) {
+		return 400, "lint_failed"
+	}
+	if isRenderError(err) {
+		return 422, "render_failed"
+	}
+	if storage.IsBackendUnavailableError(err) {
+		return 503, "backend_unavailable"
+	}
+	if repo.IsRemoteRepositoryError(err) {
+		return 502, "upstream_unavailable"
+	}
+	return 500, "internal_error"
 }
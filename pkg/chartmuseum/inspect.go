@@ -0,0 +1,185 @@
+package chartmuseum
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/ghodss/yaml"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/ptypes/any"
+	"k8s.io/helm/pkg/chartutil"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+var (
+	yamlContentType = "application/x-yaml"
+	textContentType = "text/plain; charset=utf-8"
+
+	requirementsFilename = "requirements.yaml"
+
+	errorInvalidFormat       = errors.New("format must be one of raw or json")
+	errorFileNotFoundInChart = errors.New("file not found in chart package")
+)
+
+func (server *Server) getChartMetadataRequestHandler(c *gin.Context) {
+	chart, format, err := server.chartFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	if format == "json" {
+		c.JSON(200, chart.Metadata)
+		return
+	}
+	content, err := yaml.Marshal(chart.Metadata)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	c.Data(200, yamlContentType, content)
+}
+
+func (server *Server) getChartValuesRequestHandler(c *gin.Context) {
+	chart, format, err := server.chartFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	content := []byte(chart.GetValues().GetRaw())
+	if format == "json" {
+		values, err := chartutil.ReadValues(content)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+		c.JSON(200, values)
+		return
+	}
+	c.Data(200, yamlContentType, content)
+}
+
+func (server *Server) getChartReadmeRequestHandler(c *gin.Context) {
+	chart, format, err := server.chartFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	file := chartReadmeFile(chart)
+	if file == nil {
+		errorResponse(c, errorFileNotFoundInChart)
+		return
+	}
+	if format == "json" {
+		c.JSON(200, gin.H{"name": file.TypeUrl, "content": string(file.Value)})
+		return
+	}
+	c.Data(200, textContentType, file.Value)
+}
+
+func (server *Server) getChartRequirementsRequestHandler(c *gin.Context) {
+	chart, format, err := server.chartFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	file := chartFile(chart, requirementsFilename)
+	if file == nil {
+		errorResponse(c, errorFileNotFoundInChart)
+		return
+	}
+	if format == "json" {
+		requirements := &chartutil.Requirements{}
+		err := yaml.Unmarshal(file.Value, requirements)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+		c.JSON(200, requirements)
+		return
+	}
+	c.Data(200, yamlContentType, file.Value)
+}
+
+func (server *Server) getChartTemplatesRequestHandler(c *gin.Context) {
+	chart, format, err := server.chartFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	names := []string{}
+	for _, template := range chart.Templates {
+		names = append(names, template.Name)
+	}
+	if format == "json" {
+		c.JSON(200, names)
+		return
+	}
+	c.Data(200, textContentType, []byte(strings.Join(names, "\n")))
+}
+
+// chartFromRequest loads the chart package of the chart version requested, and returns it
+// with the format requested in the format query parameter
+func (server *Server) chartFromRequest(c *gin.Context) (*helm_chart.Chart, string, error) {
+	format := c.DefaultQuery("format", "raw")
+	if format != "raw" && format != "json" {
+		return nil, "", errorInvalidFormat
+	}
+	content, err := server.getChartPackage(c.Param("name"), c.Param("version"))
+	if err != nil {
+		return nil, "", err
+	}
+	chart, err := repo.ChartFromContent(content)
+	if err != nil {
+		return nil, "", err
+	}
+	return chart, format, nil
+}
+
+// getChartPackage returns the content of the chart package of a chart version in the index
+// ("latest" for its latest version), pulling it from its upstream repository if needed when proxying
+func (server *Server) getChartPackage(name string, version string) ([]byte, error) {
+	if version == "latest" {
+		version = ""
+	}
+	err := server.syncRepositoryIndex()
+	if err != nil {
+		return nil, err
+	}
+	chartVersion, err := server.servedRepositoryIndex().Get(name, version)
+	if err != nil || len(chartVersion.URLs) == 0 {
+		return nil, repo.ErrorChartNotFound
+	}
+	filename := repo.RemoteChartPackageFilename(chartVersion.URLs[0])
+	object, err := server.StorageBackend.GetObject(filename)
+	if err == storage.ErrorObjectNotFound && server.proxy != nil {
+		return server.pullFromUpstream(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return object.Content, nil
+}
+
+// chartReadmeFile returns the readme file at the root of a chart (e.g. README.md), if any
+func chartReadmeFile(chart *helm_chart.Chart) *any.Any {
+	for _, file := range chart.Files {
+		name := strings.ToLower(file.TypeUrl)
+		if !strings.Contains(name, "/") && strings.TrimSuffix(name, path.Ext(name)) == "readme" {
+			return file
+		}
+	}
+	return nil
+}
+
+func chartFile(chart *helm_chart.Chart, name string) *any.Any {
+	for _, file := range chart.Files {
+		if file.TypeUrl == name {
+			return file
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var (
+	// totalCountHeader is the response header containing the number of results before pagination
+	totalCountHeader = "X-Total-Count"
+
+	// sortKeys maps the supported sort keys to whether they are in descending order by default
+	sortKeys = map[string]bool{
+		"name":    false,
+		"created": true,
+		"version": true,
+	}
+
+	errorInvalidPagination = errors.New("offset and limit must be non-negative integers")
+	errorInvalidSort       = errors.New("sort must be one of name, created or version, and order one of asc or desc")
+)
+
+// chartsResponse is the response of /api/charts, a map from chart name to chart versions
+// serialized with its keys in sort order rather than alphabetical order
+type chartsResponse struct {
+	names  []string
+	charts map[string]interface{}
+}
+
+// MarshalJSON writes the charts in the order of names
+func (response chartsResponse) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBufferString("{")
+	for i, name := range response.names {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(response.charts[name])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteString(":")
+		buffer.Write(value)
+	}
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
+
+// paginationFromRequest returns the offset and limit query parameters; a limit of 0 means no limit
+func paginationFromRequest(c *gin.Context) (int, int, error) {
+	offset, limit := 0, 0
+	var err error
+	if value, ok := c.GetQuery("offset"); ok {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errorInvalidPagination
+		}
+	}
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return 0, 0, errorInvalidPagination
+		}
+	}
+	return offset, limit, nil
+}
+
+// sortFromRequest returns the sort key and whether results are in descending order,
+// from the sort and order query parameters
+func sortFromRequest(c *gin.Context, defaultSort string) (string, bool, error) {
+	sortBy := c.DefaultQuery("sort", defaultSort)
+	descending, ok := sortKeys[sortBy]
+	if !ok {
+		return "", false, errorInvalidSort
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		descending = false
+	case "desc":
+		descending = true
+	default:
+		return "", false, errorInvalidSort
+	}
+	return sortBy, descending, nil
+}
+
+// fieldsFromRequest returns the chart version fields listed in the fields query parameter, if any
+func fieldsFromRequest(c *gin.Context) []string {
+	fields := []string{}
+	for _, field := range strings.Split(c.Query("fields"), ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func paginate(chartVersions []*helm_repo.ChartVersion, offset int, limit int) []*helm_repo.ChartVersion {
+	if offset >= len(chartVersions) {
+		return []*helm_repo.ChartVersion{}
+	}
+	chartVersions = chartVersions[offset:]
+	if limit > 0 && limit < len(chartVersions) {
+		chartVersions = chartVersions[:limit]
+	}
+	return chartVersions
+}
+
+// sortChartVersions returns a sorted copy of chartVersions, so that the index itself is never reordered
+func sortChartVersions(chartVersions []*helm_repo.ChartVersion, sortBy string, descending bool) []*helm_repo.ChartVersion {
+	sorted := append([]*helm_repo.ChartVersion{}, chartVersions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		result := compareChartVersions(sorted[i], sorted[j], sortBy)
+		if descending {
+			return result > 0
+		}
+		return result < 0
+	})
+	return sorted
+}
+
+// compareChartVersions compares two chart versions by a sort key, then by name and version
+func compareChartVersions(a *helm_repo.ChartVersion, b *helm_repo.ChartVersion, sortBy string) int {
+	switch sortBy {
+	case "created":
+		if !a.Created.Equal(b.Created) {
+			if a.Created.Before(b.Created) {
+				return -1
+			}
+			return 1
+		}
+	case "version":
+		if result := compareVersions(a, b); result != 0 {
+			return result
+		}
+	}
+	if result := strings.Compare(a.Name, b.Name); result != 0 {
+		return result
+	}
+	return compareVersions(a, b)
+}
+
+func compareVersions(a *helm_repo.ChartVersion, b *helm_repo.ChartVersion) int {
+	chartVersions := helm_repo.ChartVersions{a, b}
+	switch {
+	case chartVersions.Less(0, 1):
+		return -1
+	case chartVersions.Less(1, 0):
+		return 1
+	}
+	return 0
+}
+
+// selectFields returns chartVersions with only the given json fields, or unchanged if no field is given
+func selectFields(chartVersions []*helm_repo.ChartVersion, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return chartVersions, nil
+	}
+	selected := []map[string]interface{}{}
+	for _, chartVersion := range chartVersions {
+		content, err := json.Marshal(chartVersion)
+		if err != nil {
+			return nil, err
+		}
+		all := map[string]interface{}{}
+		err = json.Unmarshal(content, &all)
+		if err != nil {
+			return nil, err
+		}
+		values := map[string]interface{}{}
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				values[field] = value
+			}
+		}
+		selected = append(selected, values)
+	}
+	return selected, nil
+}
@@ -0,0 +1,225 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type (
+	// Metrics contains the prometheus collectors used to instrument a Server
+	Metrics struct {
+		Registry                  *prometheus.Registry
+		requestsTotal             *prometheus.CounterVec
+		requestDuration           *prometheus.HistogramVec
+		indexRegenerationDuration prometheus.Histogram
+		charts                    *prometheus.GaugeVec
+		chartVersions             *prometheus.GaugeVec
+		storageOperationDuration  *prometheus.HistogramVec
+		storageOperationErrors    *prometheus.CounterVec
+		uploadBytes               prometheus.Counter
+		downloadBytes             prometheus.Counter
+	}
+
+	// instrumentedBackend records latency and errors of every call made to a storage backend
+	instrumentedBackend struct {
+		storage.Backend
+		metrics *Metrics
+	}
+)
+
+// NewMetrics creates a new Metrics instance, with collectors registered in their own registry
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests served, by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "chartmuseum",
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests, by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		indexRegenerationDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "chartmuseum",
+			Name:      "index_regeneration_duration_seconds",
+			Help:      "Time taken to regenerate the repository index from storage.",
+		}),
+		charts: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "charts",
+			Help:      "Number of charts in the repository index, by repository.",
+		}, []string{"repo"}),
+		chartVersions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "chart_versions",
+			Help:      "Number of chart versions in the repository index, by repository.",
+		}, []string{"repo"}),
+		storageOperationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "chartmuseum",
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Latency of storage backend calls, by operation.",
+		}, []string{"operation"}),
+		storageOperationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "storage_operation_errors_total",
+			Help:      "Number of failed storage backend calls, by operation.",
+		}, []string{"operation"}),
+		uploadBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "upload_bytes_total",
+			Help:      "Number of bytes of chart packages and provenance files uploaded.",
+		}),
+		downloadBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "download_bytes_total",
+			Help:      "Number of bytes of chart packages and provenance files downloaded.",
+		}),
+	}
+	metrics.Registry.MustRegister(
+		metrics.requestsTotal,
+		metrics.requestDuration,
+		metrics.indexRegenerationDuration,
+		metrics.charts,
+		metrics.chartVersions,
+		metrics.storageOperationDuration,
+		metrics.storageOperationErrors,
+		metrics.uploadBytes,
+		metrics.downloadBytes,
+	)
+	return metrics
+}
+
+// Handler returns the handler for the /metrics route
+func (metrics *Metrics) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+}
+
+// routeMiddleware records requests to a route; the route is passed explicitly since
+// the router does not expose which pattern matched a request
+func (metrics *Metrics) routeMiddleware(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.requestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (metrics *Metrics) observeIndexRegeneration(start time.Time) {
+	metrics.indexRegenerationDuration.Observe(time.Since(start).Seconds())
+}
+
+func (metrics *Metrics) setIndexSize(repository string, index *repo.Index) {
+	chartVersions := 0
+	for _, versions := range index.Entries {
+		chartVersions += len(versions)
+	}
+	metrics.charts.WithLabelValues(repository).Set(float64(len(index.Entries)))
+	metrics.chartVersions.WithLabelValues(repository).Set(float64(chartVersions))
+}
+
+func (metrics *Metrics) addUploadBytes(n int) {
+	metrics.uploadBytes.Add(float64(n))
+}
+
+func (metrics *Metrics) addDownloadBytes(n int64) {
+	metrics.downloadBytes.Add(float64(n))
+}
+
+func (metrics *Metrics) observeStorageOperation(operation string, start time.Time, err error) {
+	metrics.storageOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	// a missing object is an expected outcome (e.g. checking whether a package already exists), not a failure
+	if err != nil && err != storage.ErrorObjectNotFound {
+		metrics.storageOperationErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// newInstrumentedBackend wraps a storage backend so that its calls are recorded in metrics
+func newInstrumentedBackend(backend storage.Backend, metrics *Metrics) *instrumentedBackend {
+	return &instrumentedBackend{Backend: backend, metrics: metrics}
+}
+
+// WithPrefix returns the instrumented backend scoped to a sub-prefix
+func (b *instrumentedBackend) WithPrefix(prefix string) storage.Backend {
+	prefixedBackend := b.Backend.(storage.PrefixedBackend)
+	return newInstrumentedBackend(prefixedBackend.WithPrefix(prefix), b.metrics)
+}
+
+func (b *instrumentedBackend) ListObjects() ([]storage.Object, error) {
+	start := time.Now()
+	objects, err := b.Backend.ListObjects()
+	b.metrics.observeStorageOperation("ListObjects", start, err)
+	return objects, err
+}
+
+func (b *instrumentedBackend) GetObject(path string) (storage.Object, error) {
+	start := time.Now()
+	object, err := b.Backend.GetObject(path)
+	b.metrics.observeStorageOperation("GetObject", start, err)
+	return object, err
+}
+
+func (b *instrumentedBackend) PutObject(path string, content []byte) error {
+	start := time.Now()
+	err := b.Backend.PutObject(path, content)
+	b.metrics.observeStorageOperation("PutObject", start, err)
+	return err
+}
+
+func (b *instrumentedBackend) DeleteObject(path string) error {
+	start := time.Now()
+	err := b.Backend.DeleteObject(path)
+	b.metrics.observeStorageOperation("DeleteObject", start, err)
+	return err
+}
+
+// GetObjectStream opens an object for reading, falling back to GetObject if the backend cannot stream
+func (b *instrumentedBackend) GetObjectStream(path string) (*storage.ObjectStream, error) {
+	streamingBackend, ok := b.Backend.(storage.StreamingBackend)
+	if !ok {
+		object, err := b.GetObject(path)
+		if err != nil {
+			return nil, err
+		}
+		stream := &storage.ObjectStream{
+			ReadCloser:   ioutil.NopCloser(bytes.NewReader(object.Content)),
+			Path:         object.Path,
+			Size:         int64(len(object.Content)),
+			LastModified: object.LastModified,
+		}
+		return stream, nil
+	}
+	start := time.Now()
+	stream, err := streamingBackend.GetObjectStream(path)
+	b.metrics.observeStorageOperation("GetObject", start, err)
+	return stream, err
+}
+
+// PutObjectStream writes an object from a stream, falling back to PutObject if the backend cannot stream
+func (b *instrumentedBackend) PutObjectStream(path string, content io.Reader) error {
+	streamingBackend, ok := b.Backend.(storage.StreamingBackend)
+	if !ok {
+		data, err := ioutil.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		return b.PutObject(path, data)
+	}
+	start := time.Now()
+	err := streamingBackend.PutObjectStream(path, content)
+	b.metrics.observeStorageOperation("PutObject", start, err)
+	return err
+}
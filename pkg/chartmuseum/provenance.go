@@ -0,0 +1,148 @@
+package chartmuseum
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/helm/pkg/provenance"
+)
+
+var (
+	errorProvenanceFileMissing = errors.New("no provenance file")
+)
+
+type (
+	// provenanceCheck is the result of verifying the provenance file of a chart package in storage,
+	// valid as long as neither file is modified
+	provenanceCheck struct {
+		packageModified time.Time
+		provModified    time.Time
+		err             error
+	}
+
+	// pendingPackage is a chart package in storage hidden from the index until it is signed
+	pendingPackage struct {
+		Filename     string    `json:"filename"`
+		LastModified time.Time `json:"lastModified"`
+		Reason       string    `json:"reason"`
+	}
+)
+
+func (server *Server) getPendingPackagesRequestHandler(c *gin.Context) {
+	err := server.syncRepositoryIndex()
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	c.JSON(200, server.pendingPackages())
+}
+
+// filterVerifiedObjects returns the chart packages in storage with a verified provenance file next to them;
+// only the packages whose package or provenance file changed since last listed are verified again
+func (server *Server) filterVerifiedObjects(allObjects []storage.Object, packageObjects []storage.Object) ([]storage.Object, error) {
+	provModified := map[string]time.Time{}
+	for _, object := range allObjects {
+		if strings.HasSuffix(object.Path, "."+repo.ProvenanceFileExtension) {
+			provModified[object.Path] = object.LastModified
+		}
+	}
+
+	server.provenanceChecksLock.Lock()
+	defer server.provenanceChecksLock.Unlock()
+
+	checks := map[string]provenanceCheck{}
+	verifiedObjects := []storage.Object{}
+	for _, object := range packageObjects {
+		check := provenanceCheck{packageModified: object.LastModified, err: errorProvenanceFileMissing}
+		provFilename := repo.ProvenanceFilenameFromChartPackageFilename(object.Path)
+		if modified, ok := provModified[provFilename]; ok {
+			check.provModified = modified
+			previous, ok := server.provenanceChecks[object.Path]
+			if ok && previous.packageModified.Equal(check.packageModified) && previous.provModified.Equal(modified) {
+				check.err = previous.err
+			} else {
+				check.err = server.verifyStoredProvenanceFile(provFilename)
+				if check.err != nil && !repo.IsProvenanceVerificationError(check.err) {
+					return []storage.Object{}, check.err
+				}
+			}
+		}
+		checks[object.Path] = check
+		if check.err == nil {
+			verifiedObjects = append(verifiedObjects, object)
+		}
+	}
+	server.provenanceChecks = checks
+	return verifiedObjects, nil
+}
+
+func (server *Server) verifyStoredProvenanceFile(filename string) error {
+	object, err := server.StorageBackend.GetObject(filename)
+	if err != nil {
+		return err
+	}
+	_, err = server.verifyProvenanceFile(filename, object.Content)
+	return err
+}
+
+// pendingPackages returns the chart packages whose provenance file was missing or failed verification
+// the last time storage was listed
+func (server *Server) pendingPackages() []pendingPackage {
+	server.provenanceChecksLock.Lock()
+	defer server.provenanceChecksLock.Unlock()
+
+	pending := []pendingPackage{}
+	for filename, check := range server.provenanceChecks {
+		if check.err != nil {
+			pending = append(pending, pendingPackage{
+				Filename:     filename,
+				LastModified: check.packageModified,
+				Reason:       check.err.Error(),
+			})
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Filename < pending[j].Filename
+	})
+	return pending
+}
+
+// newProvenanceSigner loads the private key used to sign uploaded chart packages from a secret keyring
+func newProvenanceSigner(keyring string, key string) (*provenance.Signatory, error) {
+	if key == "" {
+		return nil, errors.New("a signing key name is required to sign chart packages")
+	}
+	signatory, err := provenance.NewFromKeyring(keyring, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %s", err)
+	}
+	if signatory.Entity.PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", key)
+	}
+	if signatory.Entity.PrivateKey.Encrypted {
+		return nil, fmt.Errorf("signing key %s is protected by a passphrase", key)
+	}
+	return signatory, nil
+}
+
+// signChartPackage generates the provenance file of a chart package on disk, signed with the signing key,
+// unless a provenance file matching the package digest is already in storage
+func (server *Server) signChartPackage(filename string, packagePath string, digest string) ([]byte, error) {
+	provFilename := repo.ProvenanceFilenameFromChartPackageFilename(filename)
+	object, err := server.StorageBackend.GetObject(provFilename)
+	if err == nil {
+		if repo.ProvenanceFileMatchesDigest(object.Content, digest) {
+			return nil, nil
+		}
+	} else if err != storage.ErrorObjectNotFound {
+		return nil, err
+	}
+	return repo.SignChartPackageFile(server.ProvenanceSigner, packagePath)
+}
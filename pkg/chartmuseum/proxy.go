@@ -0,0 +1,190 @@
+package chartmuseum
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var (
+	// upstreamIndexMaxAge is the time after which the index files of upstream repositories are fetched again
+	upstreamIndexMaxAge = 5 * time.Minute
+)
+
+type (
+	// upstreamProxy holds the upstream repositories and their last fetched index files,
+	// shared by all repositories served
+	upstreamProxy struct {
+		remotes    []*repo.RemoteRepository
+		lock       *sync.Mutex
+		indexes    []*helm_repo.IndexFile
+		fetchedAt  time.Time
+		refreshing bool
+		generation int
+	}
+
+	// upstreamFile is the location of a file that can be pulled from an upstream repository
+	upstreamFile struct {
+		remote *repo.RemoteRepository
+		url    string
+	}
+)
+
+func newUpstreamProxy(upstreamURLs []string) *upstreamProxy {
+	proxy := &upstreamProxy{
+		remotes: []*repo.RemoteRepository{},
+		lock:    &sync.Mutex{},
+	}
+	for _, upstreamURL := range upstreamURLs {
+		proxy.remotes = append(proxy.remotes, repo.NewRemoteRepository(upstreamURL))
+	}
+	proxy.indexes = make([]*helm_repo.IndexFile, len(proxy.remotes))
+	return proxy
+}
+
+// refreshIfExpired fetches the index files of upstream repositories if they are older than upstreamIndexMaxAge;
+// an upstream that cannot be reached keeps its last known index
+func (proxy *upstreamProxy) refreshIfExpired(logger *Logger) {
+	proxy.lock.Lock()
+	if proxy.refreshing || time.Since(proxy.fetchedAt) < upstreamIndexMaxAge {
+		proxy.lock.Unlock()
+		return
+	}
+	proxy.refreshing = true
+	indexes := append([]*helm_repo.IndexFile{}, proxy.indexes...)
+	proxy.lock.Unlock()
+
+	// fetched without holding the lock, so requests are not blocked by slow upstreams
+	for i, remote := range proxy.remotes {
+		logger.Debugw("Fetching upstream repository index",
+			"upstream", remote.URL,
+		)
+		indexFile, err := remote.FetchIndex()
+		if err != nil {
+			logger.Errorw("Error fetching upstream repository index",
+				"upstream", remote.URL,
+				"error", err.Error(),
+			)
+			continue
+		}
+		indexes[i] = indexFile
+	}
+
+	proxy.lock.Lock()
+	proxy.indexes = indexes
+	proxy.fetchedAt = time.Now()
+	proxy.refreshing = false
+	proxy.generation++
+	proxy.lock.Unlock()
+}
+
+// servedRepositoryIndex returns the index served to clients: the repository index, merged with the
+// chart versions of upstream repositories not found locally when proxying
+func (server *Server) servedRepositoryIndex() *repo.Index {
+	local := server.RepositoryIndex()
+	if server.proxy == nil {
+		return local
+	}
+
+	server.proxy.lock.Lock()
+	defer server.proxy.lock.Unlock()
+
+	if server.proxyIndex != nil && server.proxyIndexLocal == local && server.proxyIndexGeneration == server.proxy.generation {
+		return server.proxyIndex
+	}
+
+	index := local.Copy()
+	upstreamFiles := map[string]upstreamFile{}
+	for i, indexFile := range server.proxy.indexes {
+		if indexFile == nil {
+			continue
+		}
+		remote := server.proxy.remotes[i]
+		// chart versions already added by a previous upstream are skipped, so the first upstream wins
+		for filename, remoteURL := range index.AddRemoteEntries(indexFile) {
+			fileURL, err := remote.ResolveURL(remoteURL)
+			if err != nil {
+				server.Logger.Warnw("Invalid chart url in upstream repository index",
+					"upstream", remote.URL,
+					"url", remoteURL,
+				)
+				continue
+			}
+			upstreamFiles[filename] = upstreamFile{remote: remote, url: fileURL}
+		}
+	}
+
+	err := index.Regenerate()
+	if err != nil {
+		server.Logger.Errorw("Error merging upstream repository indexes, serving local index only",
+			"error", err.Error(),
+		)
+		return local
+	}
+
+	server.proxyIndex = index
+	server.proxyIndexLocal = local
+	server.proxyIndexGeneration = server.proxy.generation
+	server.proxyUpstreamFiles = upstreamFiles
+	return index
+}
+
+// lookupUpstreamFile returns the location of a chart package or provenance file in an upstream repository
+func (server *Server) lookupUpstreamFile(filename string) (upstreamFile, bool) {
+	// make sure the merged index (and the upstream files it references) is up to date
+	server.servedRepositoryIndex()
+
+	server.proxy.lock.Lock()
+	defer server.proxy.lock.Unlock()
+
+	if strings.HasSuffix(filename, repo.ProvenanceFileExtension) {
+		// provenance files sit next to their chart package, as expected by helm
+		packageFilename := strings.TrimSuffix(filename, ".prov")
+		file, ok := server.proxyUpstreamFiles[packageFilename]
+		if ok {
+			file.url += ".prov"
+		}
+		return file, ok
+	}
+	file, ok := server.proxyUpstreamFiles[filename]
+	return file, ok
+}
+
+// pullFromUpstream fetches a file missing from storage from the upstream repository it comes from,
+// and saves it to storage so it is served locally from then on
+func (server *Server) pullFromUpstream(filename string) ([]byte, error) {
+	file, ok := server.lookupUpstreamFile(filename)
+	if !ok {
+		return nil, storage.ErrorObjectNotFound
+	}
+	server.Logger.Infow("Pulling file from upstream repository",
+		"object", filename,
+		"url", file.url,
+	)
+	content, err := file.remote.Fetch(file.url)
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.StorageBackend.PutObject(filename, content)
+	if err != nil {
+		// the file can still be served, it will be pulled again next time
+		server.Logger.Warnw("Unable to save file pulled from upstream repository to storage",
+			"object", filename,
+			"error", err.Error(),
+		)
+		return content, nil
+	}
+	if strings.HasSuffix(filename, repo.ChartPackageFileExtension) {
+		err = server.addChartToIndex(filename, content)
+		if err != nil {
+			server.indexUpdateFailed(filename, err)
+		}
+	}
+	return content, nil
+}
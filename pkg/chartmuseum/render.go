@@ -0,0 +1,162 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/gin-gonic/gin"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/engine"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+var (
+	// defaultReleaseName is the release name used when rendering if none is given, as with "helm template"
+	defaultReleaseName = "RELEASE-NAME"
+
+	// defaultReleaseNamespace is the release namespace used when rendering if none is given
+	defaultReleaseNamespace = "default"
+
+	notesFilename = "NOTES.txt"
+
+	errorInvalidRenderRequest = errors.New("request body must be a yaml or json object with optional name, namespace and values")
+)
+
+type (
+	// renderRequest is the body of a render request, in yaml or json
+	renderRequest struct {
+		Name      string                 `json:"name"`
+		Namespace string                 `json:"namespace"`
+		Values    map[string]interface{} `json:"values"`
+	}
+
+	// renderError is raised when the templates of a chart cannot be rendered with the values given
+	renderError struct {
+		Err error
+	}
+)
+
+func (e *renderError) Error() string {
+	return fmt.Sprintf("failed to render chart: %s", e.Err)
+}
+
+func isRenderError(err error) bool {
+	_, ok := err.(*renderError)
+	return ok
+}
+
+func (server *Server) postChartRenderRequestHandler(c *gin.Context) {
+	request, err := renderRequestFromBody(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	chart, format, err := server.chartFromRequest(c)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	manifests, notes, err := renderChart(chart, request)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	if format == "json" {
+		c.JSON(200, gin.H{"manifests": manifests, "notes": notes})
+		return
+	}
+
+	// same output as "helm template"
+	filenames := []string{}
+	for filename := range manifests {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	buffer := bytes.NewBuffer([]byte{})
+	for _, filename := range filenames {
+		fmt.Fprintf(buffer, "---\n# Source: %s\n%s\n", filename, manifests[filename])
+	}
+	c.Data(200, yamlContentType, buffer.Bytes())
+}
+
+// renderRequestFromBody reads the release name, namespace and values override from the request body, if any
+func renderRequestFromBody(c *gin.Context) (*renderRequest, error) {
+	content, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+	request := &renderRequest{}
+	if len(bytes.TrimSpace(content)) > 0 {
+		err = yaml.Unmarshal(content, request)
+		if err != nil {
+			return nil, errorInvalidRenderRequest
+		}
+	}
+	if request.Name == "" {
+		request.Name = defaultReleaseName
+	}
+	if request.Namespace == "" {
+		request.Namespace = defaultReleaseNamespace
+	}
+	return request, nil
+}
+
+// renderChart renders the templates of a chart the way tiller does on install, and returns the
+// non-empty manifests by template path along with the rendered NOTES.txt, if any
+func renderChart(chart *helm_chart.Chart, request *renderRequest) (map[string]string, string, error) {
+	config := &helm_chart.Config{}
+	if len(request.Values) > 0 {
+		raw, err := yaml.Marshal(request.Values)
+		if err != nil {
+			return nil, "", err
+		}
+		config.Raw = string(raw)
+	}
+
+	err := chartutil.ProcessRequirementsEnabled(chart, config)
+	if err != nil {
+		return nil, "", &renderError{err}
+	}
+	err = chartutil.ProcessRequirementsImportValues(chart)
+	if err != nil {
+		return nil, "", &renderError{err}
+	}
+	options := chartutil.ReleaseOptions{
+		Name:      request.Name,
+		Namespace: request.Namespace,
+		IsInstall: true,
+		Revision:  1,
+	}
+	values, err := chartutil.ToRenderValues(chart, config, options)
+	if err != nil {
+		return nil, "", &renderError{err}
+	}
+	files, err := engine.New().Render(chart, values)
+	if err != nil {
+		return nil, "", &renderError{err}
+	}
+
+	manifests := map[string]string{}
+	notes := ""
+	for filename, content := range files {
+		switch {
+		case path.Base(filename) == notesFilename:
+			// only the notes of the chart itself are shown, not those of its dependencies
+			if filename == path.Join(chart.Metadata.Name, "templates", notesFilename) {
+				notes = content
+			}
+		case strings.HasPrefix(path.Base(filename), "_"):
+			// partials only hold template definitions
+		case strings.TrimSpace(content) == "":
+			// templates disabled by a condition render to nothing
+		default:
+			manifests[filename] = content
+		}
+	}
+	return manifests, notes, nil
+}
@@ -0,0 +1,186 @@
+package chartmuseum
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	repositoryNameSegmentRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+	errorInvalidRepositoryName = errors.New("invalid repository name")
+	errorRepositoryNotFound    = errors.New("repository not found")
+)
+
+type (
+	// repositoryEntry is a nested repository, loaded once by the first request for it
+	repositoryEntry struct {
+		once   sync.Once
+		server *Server
+		err    error
+		loaded bool
+	}
+)
+
+// repositoryPathPrefix returns the route prefix identifying a repository, with one parameter
+// per level of nesting (e.g. /:repo1/:repo2 for a depth of 2)
+func (server *Server) repositoryPathPrefix() string {
+	prefix := ""
+	for i := 1; i <= server.Depth; i++ {
+		prefix = fmt.Sprintf("%s/:repo%d", prefix, i)
+	}
+	return prefix
+}
+
+// repositoryHandler calls handler with the server of the repository requested, which must exist in storage
+func (server *Server) repositoryHandler(handler func(*Server, *gin.Context)) gin.HandlerFunc {
+	return server.newRepositoryHandler(handler, false)
+}
+
+// creatingRepositoryHandler calls handler with the server of the repository requested,
+// creating the repository if it does not exist in storage yet (routes uploading to a repository)
+func (server *Server) creatingRepositoryHandler(handler func(*Server, *gin.Context)) gin.HandlerFunc {
+	return server.newRepositoryHandler(handler, true)
+}
+
+func (server *Server) newRepositoryHandler(handler func(*Server, *gin.Context), create bool) gin.HandlerFunc {
+	if server.Depth == 0 {
+		return func(c *gin.Context) {
+			handler(server, c)
+		}
+	}
+	return func(c *gin.Context) {
+		name, err := server.repositoryNameFromRequest(c)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+		repository, err := server.getRepository(name, create)
+		if err != nil {
+			errorResponse(c, err)
+			return
+		}
+		handler(repository, c)
+	}
+}
+
+func (server *Server) repositoryNameFromRequest(c *gin.Context) (string, error) {
+	segments := []string{}
+	for i := 1; i <= server.Depth; i++ {
+		segment := c.Param(fmt.Sprintf("repo%d", i))
+		if !repositoryNameSegmentRegexp.MatchString(segment) {
+			return "", errorInvalidRepositoryName
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// getRepository returns the server for a nested repository, loading its index the first time it is requested;
+// repositories with nothing in storage are only loaded if create is set
+func (server *Server) getRepository(name string, create bool) (*Server, error) {
+	server.repositoriesLock.Lock()
+	entry, ok := server.repositories[name]
+	server.repositoriesLock.Unlock()
+
+	if !ok {
+		repository := server.newRepository(name)
+		if !create {
+			// only checked for repositories not loaded yet, without holding the lock
+			exists, err := repository.existsInStorage()
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				return nil, errorRepositoryNotFound
+			}
+		}
+		server.repositoriesLock.Lock()
+		entry, ok = server.repositories[name]
+		if !ok {
+			entry = &repositoryEntry{server: repository}
+			server.repositories[name] = entry
+		}
+		server.repositoriesLock.Unlock()
+	}
+
+	// other repositories can be requested (and loaded) while this one is loading
+	entry.once.Do(func() {
+		server.Logger.Infow("Loading repository",
+			"repo", name,
+		)
+		entry.err = entry.server.initRepositoryIndex()
+		server.repositoriesLock.Lock()
+		if entry.err != nil {
+			// retried on the next request
+			delete(server.repositories, name)
+		} else {
+			entry.loaded = true
+		}
+		server.repositoriesLock.Unlock()
+	})
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.server, nil
+}
+
+// newRepository returns the server for a nested repository, sharing all settings of the server
+func (server *Server) newRepository(name string) *Server {
+	chartURL := ""
+	if parentChartURL := server.RepositoryIndex().ChartURL; parentChartURL != "" {
+		chartURL = strings.Join([]string{parentChartURL, name}, "/")
+	}
+
+	// start from a copy so the repository shares all settings of the server
+	repository := *server
+	repository.Depth = 0
+	repository.Repository = name
+	repository.repositoryIndex = repo.NewIndex(chartURL)
+	repository.repositoryIndexLock = &sync.RWMutex{}
+	repository.StorageBackend = server.StorageBackend.(storage.PrefixedBackend).WithPrefix(name)
+	repository.StorageCache = []storage.Object{}
+	repository.StorageCacheLock = &sync.Mutex{}
+	repository.indexRefreshSignal = make(chan struct{}, 1)
+	repository.indexSyncStatusLock = &sync.Mutex{}
+	repository.lastIndexSync = time.Time{}
+	repository.lastIndexSyncErr = nil
+	repository.repositories = nil
+	repository.repositoriesLock = nil
+	repository.proxyIndex = nil
+	repository.proxyIndexLocal = nil
+	repository.proxyUpstreamFiles = nil
+	repository.provenanceChecks = map[string]provenanceCheck{}
+	repository.provenanceChecksLock = &sync.Mutex{}
+	return &repository
+}
+
+// existsInStorage determines whether or not anything was saved to storage for a nested repository
+func (server *Server) existsInStorage() (bool, error) {
+	objects, err := server.StorageBackend.ListObjects()
+	if err != nil {
+		return false, err
+	}
+	return len(objects) > 0, nil
+}
+
+func (server *Server) loadedRepositories() []*Server {
+	server.repositoriesLock.Lock()
+	defer server.repositoriesLock.Unlock()
+	repositories := []*Server{}
+	for _, entry := range server.repositories {
+		if entry.loaded {
+			repositories = append(repositories, entry.server)
+		}
+	}
+	return repositories
+}
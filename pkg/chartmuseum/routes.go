@@ -1,17 +1,60 @@
 package chartmuseum
 
-func (server *Server) setRoutes(enableAPI bool) {
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func (server *Server) setRoutes(enableAPI bool, enableMetrics bool) {
+	// Probes (no authentication, never sync the index)
+	server.Router.GET("/health", server.getHealthRequestHandler)
+	server.Router.GET("/ready", server.getReadyRequestHandler)
+
+	prefix := server.repositoryPathPrefix()
+
 	// Helm Chart Repository
-	server.Router.GET("/index.yaml", server.getIndexFileRequestHandler)
-	server.Router.GET("/charts/:filename", server.getStorageObjectRequestHandler)
+	var repositoryRoutes gin.IRoutes = server.Router
+	if server.Depth > 0 {
+		// routes starting with a parameter conflict with any other route at the same level,
+		// so they are served by a separate engine for requests not matching other routes
+		engine := gin.New()
+		server.Router.NoRoute(gin.WrapH(engine))
+		repositoryRoutes = engine
+	}
+	server.handle(repositoryRoutes, "GET", prefix+"/index.yaml", ScopePull, true, server.repositoryHandler((*Server).getIndexFileRequestHandler))
+	server.handle(repositoryRoutes, "GET", prefix+"/charts/:filename", ScopePull, true, server.repositoryHandler((*Server).getStorageObjectRequestHandler))
 
 	// Chart Manipulation
 	if enableAPI {
-		server.Router.GET("/api/charts", server.getAllChartsRequestHandler)
-		server.Router.POST("/api/charts", server.postPackageRequestHandler)
-		server.Router.POST("/api/prov", server.postProvenanceFileRequestHandler)
-		server.Router.GET("/api/charts/:name", server.getChartRequestHandler)
-		server.Router.GET("/api/charts/:name/:version", server.getChartVersionRequestHandler)
-		server.Router.DELETE("/api/charts/:name/:version", server.deleteChartVersionRequestHandler)
+		api := "/api" + prefix
+		server.handle(server.Router, "GET", api+"/charts", ScopePull, true, server.repositoryHandler((*Server).getAllChartsRequestHandler))
+		server.handle(server.Router, "GET", api+"/search", ScopePull, true, server.repositoryHandler((*Server).getSearchRequestHandler))
+		server.handle(server.Router, "GET", api+"/pending", ScopePull, true, server.repositoryHandler((*Server).getPendingPackagesRequestHandler))
+		server.handle(server.Router, "POST", api+"/charts", ScopePush, false, server.creatingRepositoryHandler((*Server).postPackageRequestHandler))
+		server.handle(server.Router, "POST", api+"/prov", ScopePush, false, server.creatingRepositoryHandler((*Server).postProvenanceFileRequestHandler))
+		server.handle(server.Router, "GET", api+"/charts/:name", ScopePull, true, server.repositoryHandler((*Server).getChartRequestHandler))
+		server.handle(server.Router, "GET", api+"/charts/:name/:version", ScopePull, true, server.repositoryHandler((*Server).getChartVersionRequestHandler))
+		server.handle(server.Router, "DELETE", api+"/charts/:name/:version", ScopeDelete, false, server.repositoryHandler((*Server).deleteChartVersionRequestHandler))
+		server.handle(server.Router, "GET", api+"/charts/:name/:version/chart", ScopePull, true, server.repositoryHandler((*Server).getChartMetadataRequestHandler))
+		server.handle(server.Router, "GET", api+"/charts/:name/:version/values", ScopePull, true, server.repositoryHandler((*Server).getChartValuesRequestHandler))
+		server.handle(server.Router, "GET", api+"/charts/:name/:version/readme", ScopePull, true, server.repositoryHandler((*Server).getChartReadmeRequestHandler))
+		server.handle(server.Router, "GET", api+"/charts/:name/:version/requirements", ScopePull, true, server.repositoryHandler((*Server).getChartRequirementsRequestHandler))
+		server.handle(server.Router, "GET", api+"/charts/:name/:version/templates", ScopePull, true, server.repositoryHandler((*Server).getChartTemplatesRequestHandler))
+		server.handle(server.Router, "POST", api+"/charts/:name/:version/render", ScopePull, false, server.repositoryHandler((*Server).postChartRenderRequestHandler))
+	}
+
+	// Observability
+	if enableMetrics {
+		server.handle(server.Router, "GET", "/metrics", ScopePull, false, server.Metrics.Handler())
+	}
+}
+
+// handle registers a route whose requests are recorded in metrics and require authentication with a scope, if enabled,
+// unless the route is public and anonymous GET is allowed
+func (server *Server) handle(routes gin.IRoutes, method string, path string, scope string, public bool, handler gin.HandlerFunc) {
+	handlers := []gin.HandlerFunc{server.Metrics.routeMiddleware(path)}
+	if server.Router.auth != nil {
+		handlers = append(handlers, server.Router.auth.middleware(scope, public))
 	}
+	handlers = append(handlers, handler)
+	routes.Handle(method, path, handlers...)
 }
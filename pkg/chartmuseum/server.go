@@ -1,6 +1,7 @@
 package chartmuseum
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -11,9 +12,20 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/provenance"
 	helm_repo "k8s.io/helm/pkg/repo"
 )
 
+var (
+	// readyIndexMaxAgeIntervals is the number of background refresh intervals after which
+	// an index that could not be refreshed is considered stale
+	readyIndexMaxAgeIntervals time.Duration = 3
+
+	// readyCheckObjectPath is the storage object requested to check the storage backend is reachable
+	readyCheckObjectPath = ".chartmuseum-ready-check"
+)
+
 type (
 	// Logger handles all logging from application
 	Logger struct {
@@ -23,31 +35,72 @@ type (
 	// Router handles all incoming HTTP requests
 	Router struct {
 		*gin.Engine
+		auth *authenticator
 	}
 
-	// Server contains a Logger, Router, storage backend and object cache
+	// Server contains a Logger, Router, Metrics, storage backend and object cache
 	Server struct {
-		Logger           *Logger
-		Router           *Router
-		RepositoryIndex  *repo.Index
-		StorageBackend   storage.Backend
-		StorageCache     []storage.Object
-		StorageCacheLock *sync.Mutex
-		TlsCert          string
-		TlsKey           string
+		Logger               *Logger
+		Router               *Router
+		Metrics              *Metrics
+		Depth                int
+		Repository           string
+		StorageBackend       storage.Backend
+		StorageCache         []storage.Object
+		StorageCacheLock     *sync.Mutex
+		PersistIndexCache    bool
+		IndexRefreshInterval time.Duration
+		AllowOverwrite       bool
+		LintOnUpload         bool
+		LintSeverity         int
+		ProvenanceVerifier   *provenance.Signatory
+		RequireProvenance    bool
+		ProvenanceSigner     *provenance.Signatory
+		TlsCert              string
+		TlsKey               string
+		repositoryIndex      *repo.Index
+		repositoryIndexLock  *sync.RWMutex
+		indexRefreshSignal   chan struct{}
+		indexSyncStatusLock  *sync.Mutex
+		lastIndexSync        time.Time
+		lastIndexSyncErr     error
+		repositories         map[string]*repositoryEntry
+		repositoriesLock     *sync.Mutex
+		proxy                *upstreamProxy
+		proxyIndex           *repo.Index
+		proxyIndexLocal      *repo.Index
+		proxyIndexGeneration int
+		proxyUpstreamFiles   map[string]upstreamFile
+		provenanceChecks     map[string]provenanceCheck
+		provenanceChecksLock *sync.Mutex
 	}
 
 	// ServerOptions are options for constructing a Server
 	ServerOptions struct {
-		StorageBackend storage.Backend
-		LogJSON        bool
-		Debug          bool
-		EnableAPI      bool
-		ChartURL       string
-		TlsCert        string
-		TlsKey         string
-		Username       string
-		Password       string
+		StorageBackend       storage.Backend
+		LogJSON              bool
+		Debug                bool
+		EnableAPI            bool
+		EnableMetrics        bool
+		ChartURL             string
+		TlsCert              string
+		TlsKey               string
+		Username             string
+		Password             string
+		PersistIndexCache    bool
+		IndexRefreshInterval time.Duration
+		AllowOverwrite       bool
+		Depth                int
+		ProxyUpstreams       []string
+		LintOnUpload         bool
+		LintSeverity         string
+		Keyring              string
+		RequireProvenance    bool
+		SigningKeyring       string
+		SigningKey           string
+		AuthTokenFile        string
+		AuthJWTPublicKey     string
+		AuthAnonymousGet     bool
 	}
 )
 
@@ -77,12 +130,14 @@ func NewRouter(logger *Logger, username string, password string) *Router {
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
 	engine.Use(loggingMiddleware(logger), gin.Recovery())
+	router := &Router{Engine: engine}
 	if username != "" && password != "" {
 		users := make(map[string]string)
 		users[username] = password
-		engine.Use(gin.BasicAuthForRealm(users, "ChartMuseum"))
+		// applied per route, so that probes such as /health do not require credentials
+		router.auth = &authenticator{users: users}
 	}
-	return &Router{engine}
+	return router
 }
 
 // NewServer creates a new Server instance
@@ -92,22 +147,97 @@ func NewServer(options ServerOptions) (*Server, error) {
 		return new(Server), nil
 	}
 
+	lintSeverity, err := repo.LintSeverityFromString(options.LintSeverity)
+	if err != nil {
+		return new(Server), err
+	}
+
+	if options.RequireProvenance && options.Keyring == "" {
+		return new(Server), errors.New("a keyring is required to require provenance files")
+	}
+	if options.RequireProvenance && len(options.ProxyUpstreams) > 0 {
+		// upstream chart versions are published without their provenance files
+		return new(Server), errors.New("provenance files cannot be required when proxying upstream repositories")
+	}
+	var provenanceVerifier *provenance.Signatory
+	if options.Keyring != "" {
+		provenanceVerifier, err = provenance.NewFromKeyring(options.Keyring, "")
+		if err != nil {
+			return new(Server), fmt.Errorf("failed to load keyring: %s", err)
+		}
+	}
+
+	var provenanceSigner *provenance.Signatory
+	if options.SigningKeyring != "" {
+		provenanceSigner, err = newProvenanceSigner(options.SigningKeyring, options.SigningKey)
+		if err != nil {
+			return new(Server), err
+		}
+		// generated provenance files are published without being verified
+		if options.RequireProvenance && len(provenanceVerifier.KeyRing.KeysById(provenanceSigner.Entity.PrimaryKey.KeyId)) == 0 {
+			return new(Server), fmt.Errorf("signing key %s must be in the keyring to require provenance files", options.SigningKey)
+		}
+	}
+
 	router := NewRouter(logger, options.Username, options.Password)
+	if options.AuthTokenFile != "" || options.AuthJWTPublicKey != "" {
+		err = router.enableTokenAuth(options.AuthTokenFile, options.AuthJWTPublicKey)
+		if err != nil {
+			return new(Server), err
+		}
+	}
+	if router.auth != nil {
+		router.auth.anonymousGet = options.AuthAnonymousGet
+	}
+	metrics := NewMetrics()
 
 	server := &Server{
-		Logger:           logger,
-		Router:           router,
-		RepositoryIndex:  repo.NewIndex(options.ChartURL),
-		StorageBackend:   options.StorageBackend,
-		StorageCache:     []storage.Object{},
-		StorageCacheLock: &sync.Mutex{},
-		TlsCert:          options.TlsCert,
-		TlsKey:           options.TlsKey,
+		Logger:               logger,
+		Router:               router,
+		Metrics:              metrics,
+		Depth:                options.Depth,
+		StorageBackend:       newInstrumentedBackend(options.StorageBackend, metrics),
+		StorageCache:         []storage.Object{},
+		StorageCacheLock:     &sync.Mutex{},
+		PersistIndexCache:    options.PersistIndexCache,
+		IndexRefreshInterval: options.IndexRefreshInterval,
+		AllowOverwrite:       options.AllowOverwrite,
+		LintOnUpload:         options.LintOnUpload,
+		LintSeverity:         lintSeverity,
+		ProvenanceVerifier:   provenanceVerifier,
+		RequireProvenance:    options.RequireProvenance,
+		ProvenanceSigner:     provenanceSigner,
+		TlsCert:              options.TlsCert,
+		TlsKey:               options.TlsKey,
+		repositoryIndex:      repo.NewIndex(options.ChartURL),
+		repositoryIndexLock:  &sync.RWMutex{},
+		indexRefreshSignal:   make(chan struct{}, 1),
+		indexSyncStatusLock:  &sync.Mutex{},
+		repositories:         map[string]*repositoryEntry{},
+		repositoriesLock:     &sync.Mutex{},
+		provenanceChecks:     map[string]provenanceCheck{},
+		provenanceChecksLock: &sync.Mutex{},
+	}
+
+	if len(options.ProxyUpstreams) > 0 {
+		server.proxy = newUpstreamProxy(options.ProxyUpstreams)
+		server.proxy.refreshIfExpired(server.Logger)
+	}
+
+	if server.Depth > 0 {
+		if _, ok := options.StorageBackend.(storage.PrefixedBackend); !ok {
+			return server, errors.New("storage backend does not support nested repositories")
+		}
 	}
 
-	server.setRoutes(options.EnableAPI)
+	server.setRoutes(options.EnableAPI, options.EnableMetrics)
+
+	if server.Depth > 0 {
+		// each repository is loaded the first time it is requested
+		return server, nil
+	}
 
-	err = server.regenerateRepositoryIndex()
+	err = server.initRepositoryIndex()
 	return server, err
 }
 
@@ -152,18 +282,133 @@ func loggingMiddleware(logger *Logger) gin.HandlerFunc {
 	}
 }
 
-func (server *Server) syncRepositoryIndex() error {
-	_, diff, err := server.listObjectsGetDiff()
+// initRepositoryIndex builds the index for the first time and starts the background refresher, if enabled
+func (server *Server) initRepositoryIndex() error {
+	if server.PersistIndexCache {
+		server.loadIndexCache()
+	}
+
+	err := server.regenerateRepositoryIndex()
 	if err != nil {
 		return err
 	}
-	if !diff.Change {
+	server.setIndexSyncStatus(nil)
+
+	if server.IndexRefreshInterval > 0 {
+		go server.refreshRepositoryIndexPeriodically()
+	}
+	return nil
+}
+
+func (server *Server) syncRepositoryIndex() error {
+	if server.IndexRefreshInterval > 0 {
+		// the index is kept up to date in the background, serve the last known version from memory
 		return nil
 	}
-	err = server.regenerateRepositoryIndex()
+	return server.refreshRepositoryIndex()
+}
+
+// requestIndexRefresh wakes up the background refresher, if any, without waiting for the next interval
+func (server *Server) requestIndexRefresh() {
+	if server.IndexRefreshInterval <= 0 {
+		return
+	}
+	select {
+	case server.indexRefreshSignal <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
+func (server *Server) refreshRepositoryIndexPeriodically() {
+	ticker := time.NewTicker(server.IndexRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-server.indexRefreshSignal:
+		}
+		server.Logger.Debug("Refreshing repository index in background")
+		err := server.refreshRepositoryIndex()
+		if err != nil {
+			server.Logger.Errorw("Error refreshing repository index in background",
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+func (server *Server) refreshRepositoryIndex() error {
+	if server.proxy != nil {
+		server.proxy.refreshIfExpired(server.Logger)
+	}
+	server.StorageCacheLock.Lock()
+	_, diff, err := server.listObjectsGetDiff()
+	server.StorageCacheLock.Unlock()
+	if err == nil && diff.Change {
+		err = server.regenerateRepositoryIndex()
+	}
+	server.setIndexSyncStatus(err)
 	return err
 }
 
+func (server *Server) setIndexSyncStatus(err error) {
+	server.indexSyncStatusLock.Lock()
+	defer server.indexSyncStatusLock.Unlock()
+	if err == nil {
+		server.lastIndexSync = time.Now()
+	}
+	server.lastIndexSyncErr = err
+}
+
+// checkReady returns the reason why the server should not receive traffic yet, if any
+func (server *Server) checkReady() error {
+	if server.Depth > 0 {
+		// only repositories requested so far are loaded
+		for _, repository := range server.loadedRepositories() {
+			err := repository.checkIndexSyncStatus()
+			if err != nil {
+				return fmt.Errorf("repository %s: %s", repository.Repository, err)
+			}
+		}
+	} else {
+		err := server.checkIndexSyncStatus()
+		if err != nil {
+			return err
+		}
+	}
+
+	// a missing object means the backend answered, which is all that matters here
+	_, err := server.StorageBackend.GetObject(readyCheckObjectPath)
+	if err != nil && err != storage.ErrorObjectNotFound {
+		return err
+	}
+	return nil
+}
+
+func (server *Server) checkIndexSyncStatus() error {
+	server.indexSyncStatusLock.Lock()
+	lastIndexSync, lastIndexSyncErr := server.lastIndexSync, server.lastIndexSyncErr
+	server.indexSyncStatusLock.Unlock()
+
+	if lastIndexSync.IsZero() {
+		return errors.New("repository index not built yet")
+	}
+
+	if server.IndexRefreshInterval > 0 {
+		if lastIndexSyncErr != nil {
+			return fmt.Errorf("last background index refresh failed: %s", lastIndexSyncErr)
+		}
+		maxAge := readyIndexMaxAgeIntervals * server.IndexRefreshInterval
+		if age := time.Since(lastIndexSync); age > maxAge {
+			return fmt.Errorf("last successful background index refresh was %s ago", age)
+		}
+	}
+	return nil
+}
+
+// listObjectsGetDiff lists chart packages in storage and compares them with the storage cache;
+// must be called with storage cache lock held
 func (server *Server) listObjectsGetDiff() ([]storage.Object, storage.ObjectSliceDiff, error) {
 	allObjects, err := server.StorageBackend.ListObjects()
 	if err != nil {
@@ -178,6 +423,14 @@ func (server *Server) listObjectsGetDiff() ([]storage.Object, storage.ObjectSlic
 		}
 	}
 
+	// unsigned chart packages are left out, as if they were not in storage yet
+	if server.RequireProvenance {
+		filteredObjects, err = server.filterVerifiedObjects(allObjects, filteredObjects)
+		if err != nil {
+			return []storage.Object{}, storage.ObjectSliceDiff{}, err
+		}
+	}
+
 	diff := storage.GetObjectSliceDiff(server.StorageCache, filteredObjects)
 	return filteredObjects, diff, nil
 }
@@ -190,17 +443,15 @@ func (server *Server) regenerateRepositoryIndex() error {
 		server.Logger.Debugw("Releasing storage cache lock")
 		server.StorageCacheLock.Unlock()
 	}()
+	defer server.Metrics.observeIndexRegeneration(time.Now())
 
 	objects, diff, err := server.listObjectsGetDiff()
 	if err != nil {
 		return err
 	}
 
-	index := &repo.Index{
-		IndexFile: server.RepositoryIndex.IndexFile,
-		Raw:       server.RepositoryIndex.Raw,
-		ChartURL:  server.RepositoryIndex.ChartURL,
-	}
+	// work on a copy so requests can keep reading the current index while it is regenerated
+	index := server.RepositoryIndex().Copy()
 
 	for _, object := range diff.Removed {
 		err := server.removeIndexObject(index, object)
@@ -218,14 +469,15 @@ func (server *Server) regenerateRepositoryIndex() error {
 
 	// Parallelize retrieval of added objects to improve startup speed
 	var wg sync.WaitGroup
+	var addLock sync.Mutex
 	wg.Add(len(diff.Added))
 	for _, object := range diff.Added {
 		go func(o storage.Object) {
 			defer wg.Done()
-			if err == nil {
-				if e := server.addIndexObject(index, o); e != nil {
-					err = e
-				}
+			if e := server.addIndexObject(index, o, &addLock); e != nil {
+				addLock.Lock()
+				err = e
+				addLock.Unlock()
 			}
 		}(object)
 	}
@@ -240,11 +492,174 @@ func (server *Server) regenerateRepositoryIndex() error {
 		return err
 	}
 
-	server.RepositoryIndex = index
-	server.StorageCache = objects
+	server.setRepositoryIndex(index, objects, diff.Change)
+	return nil
+}
+
+// addChartToIndex adds (or updates, if overwritten) a chart package that was just saved to storage in the index,
+// so it is visible immediately without listing the whole storage backend
+func (server *Server) addChartToIndex(filename string, content []byte) error {
+	chartVersion, err := repo.ChartVersionFromStorageObject(storage.Object{Path: filename, Content: content})
+	if err != nil {
+		return err
+	}
+	return server.addChartVersionToIndex(filename, chartVersion)
+}
+
+// addChartVersionToIndex adds the chart version of a chart package that was just saved to storage in the index
+func (server *Server) addChartVersionToIndex(filename string, chartVersion *helm_repo.ChartVersion) error {
+	// the modification time in storage, so the package is not seen as updated the next time storage is listed
+	lastModified, err := server.storageObjectLastModified(filename)
+	if err != nil {
+		return err
+	}
+	chartVersion.Created = lastModified
+
+	server.StorageCacheLock.Lock()
+	defer server.StorageCacheLock.Unlock()
+
+	index := server.RepositoryIndex().Copy()
+	if index.Has(chartVersion.Name, chartVersion.Version) {
+		index.UpdateEntry(chartVersion)
+	} else {
+		index.AddEntry(chartVersion)
+	}
+	err = index.Regenerate()
+	if err != nil {
+		return err
+	}
+
+	object := storage.Object{
+		Path:         filename,
+		Content:      []byte{},
+		LastModified: lastModified,
+	}
+	objects := append(removeStorageCacheObject(server.StorageCache, filename), object)
+	server.setRepositoryIndex(index, objects, true)
+	return nil
+}
+
+// storageObjectLastModified returns the modification time of an object in storage,
+// without downloading its content if the backend can stream
+func (server *Server) storageObjectLastModified(filename string) (time.Time, error) {
+	if backend, ok := server.StorageBackend.(storage.StreamingBackend); ok {
+		stream, err := backend.GetObjectStream(filename)
+		if err != nil {
+			return time.Time{}, err
+		}
+		stream.Close()
+		return stream.LastModified, nil
+	}
+	object, err := server.StorageBackend.GetObject(filename)
+	return object.LastModified, err
+}
+
+// removeChartFromIndex removes a chart package that was just deleted from storage from the index
+func (server *Server) removeChartFromIndex(name string, version string) error {
+	server.StorageCacheLock.Lock()
+	defer server.StorageCacheLock.Unlock()
+
+	chartVersion := &helm_repo.ChartVersion{
+		Metadata: &helm_chart.Metadata{Name: name, Version: version},
+	}
+
+	index := server.RepositoryIndex().Copy()
+	index.RemoveEntry(chartVersion)
+	err := index.Regenerate()
+	if err != nil {
+		return err
+	}
+
+	filename := repo.ChartPackageFilenameFromNameVersion(name, version)
+	objects := removeStorageCacheObject(server.StorageCache, filename)
+	server.setRepositoryIndex(index, objects, true)
 	return nil
 }
 
+// RepositoryIndex returns the current repository index, which is replaced rather than modified when regenerated
+func (server *Server) RepositoryIndex() *repo.Index {
+	server.repositoryIndexLock.RLock()
+	defer server.repositoryIndexLock.RUnlock()
+	return server.repositoryIndex
+}
+
+// setRepositoryIndex replaces the served index and storage cache; must be called with storage cache lock held
+func (server *Server) setRepositoryIndex(index *repo.Index, objects []storage.Object, changed bool) {
+	server.repositoryIndexLock.Lock()
+	server.repositoryIndex = index
+	server.repositoryIndexLock.Unlock()
+	server.StorageCache = objects
+	server.Metrics.setIndexSize(server.Repository, index)
+
+	if server.PersistIndexCache && changed {
+		server.saveIndexCache()
+	}
+}
+
+func removeStorageCacheObject(objects []storage.Object, path string) []storage.Object {
+	filtered := []storage.Object{}
+	for _, object := range objects {
+		if object.Path != path {
+			filtered = append(filtered, object)
+		}
+	}
+	return filtered
+}
+
+func (server *Server) loadIndexCache() {
+	object, err := server.StorageBackend.GetObject(repo.IndexCacheFilename)
+	if err != nil {
+		server.Logger.Debugw("No index cache loaded from storage",
+			"error", err.Error(),
+		)
+		return
+	}
+	cache, err := repo.IndexCacheFromContent(object.Content)
+	if err != nil {
+		server.Logger.Warnw("Invalid index cache in storage, ignoring",
+			"error", err.Error(),
+		)
+		return
+	}
+	if cache.ChartURL != server.RepositoryIndex().ChartURL {
+		server.Logger.Infow("Index cache in storage was generated with a different chart url, ignoring",
+			"chartURL", cache.ChartURL,
+		)
+		return
+	}
+	index, err := cache.Index()
+	if err != nil {
+		server.Logger.Warnw("Unable to regenerate index from index cache, ignoring",
+			"error", err.Error(),
+		)
+		return
+	}
+	server.Logger.Infow("Loaded index cache from storage",
+		"objects", len(cache.Objects),
+	)
+	server.repositoryIndexLock.Lock()
+	server.repositoryIndex = index
+	server.repositoryIndexLock.Unlock()
+	server.StorageCache = cache.StorageObjects()
+}
+
+// saveIndexCache persists the current index and storage cache; must be called with storage cache lock held
+func (server *Server) saveIndexCache() {
+	cache := repo.NewIndexCache(server.RepositoryIndex(), server.StorageCache)
+	content, err := cache.Content()
+	if err == nil {
+		server.Logger.Debugw("Saving index cache to storage",
+			"objects", len(cache.Objects),
+		)
+		err = server.StorageBackend.PutObject(repo.IndexCacheFilename, content)
+	}
+	if err != nil {
+		server.Logger.Warnw("Unable to save index cache to storage",
+			"error", err.Error(),
+		)
+	}
+}
+
 func (server *Server) removeIndexObject(index *repo.Index, object storage.Object) error {
 	chartVersion, err := server.getObjectChartVersion(object, false)
 	if err != nil {
@@ -271,7 +686,8 @@ func (server *Server) updateIndexObject(index *repo.Index, object storage.Object
 	return nil
 }
 
-func (server *Server) addIndexObject(index *repo.Index, object storage.Object) error {
+// addIndexObject may be called concurrently, so the index is only modified while holding indexLock
+func (server *Server) addIndexObject(index *repo.Index, object storage.Object, indexLock *sync.Mutex) error {
 	chartVersion, err := server.getObjectChartVersion(object, true)
 	if err != nil {
 		return server.checkInvalidChartPackageError(object, err, "added")
@@ -280,7 +696,9 @@ func (server *Server) addIndexObject(index *repo.Index, object storage.Object) e
 		"name", chartVersion.Name,
 		"version", chartVersion.Version,
 	)
+	indexLock.Lock()
 	index.AddEntry(chartVersion)
+	indexLock.Unlock()
 	return nil
 }
 
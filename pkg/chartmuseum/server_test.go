@@ -2,24 +2,73 @@ package chartmuseum
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	pathutil "path"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
 	"github.com/chartmuseum/chartmuseum/pkg/storage"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/openpgp"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/provenance"
+	helm_repo "k8s.io/helm/pkg/repo"
 )
 
 var testTarballPath = "../../testdata/charts/mychart/mychart-0.1.0.tgz"
 var testProvfilePath = "../../testdata/charts/mychart/mychart-0.1.0.tgz.prov"
+var testMaintainersTarballPath = "../../testdata/charts/otherchart/otherchart-0.2.0.tgz"
+var testMaintainersProvfilePath = "../../testdata/charts/otherchart/otherchart-0.2.0.tgz.prov"
+var testKeyringPath = "../../testdata/pgp/helm-test-key.pub"
+var testSigningKeyringPath = "../../testdata/pgp/helm-test-key.secret"
+
+// provFailingBackend is a storage backend failing to save provenance files
+type provFailingBackend struct {
+	storage.Backend
+}
+
+func (b provFailingBackend) PutObject(path string, content []byte) error {
+	if strings.HasSuffix(path, ".prov") {
+		return &storage.BackendUnavailableError{Err: fmt.Errorf("disk full")}
+	}
+	return b.Backend.PutObject(path, content)
+}
+
+// countingBackend is a storage backend counting the chart packages fetched from storage
+type countingBackend struct {
+	storage.Backend
+	fetched *int32
+}
+
+func (b countingBackend) GetObject(path string) (storage.Object, error) {
+	if strings.HasSuffix(path, repo.ChartPackageFileExtension) {
+		atomic.AddInt32(b.fetched, 1)
+	}
+	return b.Backend.GetObject(path)
+}
+
+// basicAuthorization returns the Authorization header value of basic http authentication
+func basicAuthorization(username string, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
 
 type ServerTestSuite struct {
 	suite.Suite
@@ -46,6 +95,27 @@ func (suite *ServerTestSuite) doRequest(broken bool, disabled bool, method strin
 	return c.Writer
 }
 
+// testRequestFunc sends a request with a body and headers to a test server and records the response
+type testRequestFunc func(method string, urlStr string, body []byte, header http.Header) *httptest.ResponseRecorder
+
+// newTestServer creates a server for a test, along with a function sending it requests
+func (suite *ServerTestSuite) newTestServer(options ServerOptions) (*Server, testRequestFunc) {
+	server, err := NewServer(options)
+	suite.Nil(err, "no error creating new server")
+
+	doRequest := func(method string, urlStr string, body []byte, header http.Header) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request, _ = http.NewRequest(method, urlStr, bytes.NewBuffer(body))
+		for key, values := range header {
+			c.Request.Header[key] = values
+		}
+		server.Router.HandleContext(c)
+		return recorder
+	}
+	return server, doRequest
+}
+
 func (suite *ServerTestSuite) SetupSuite() {
 	srcFileTarball, err := os.Open(testTarballPath)
 	suite.Nil(err, "no error opening test tarball")
@@ -60,20 +130,43 @@ func (suite *ServerTestSuite) SetupSuite() {
 
 	backend := storage.Backend(storage.NewLocalFilesystemBackend(suite.TempDirectory))
 
-	server, err := NewServer(ServerOptions{backend, false, false, true, "", "", "", "", ""})
+	server, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		LogJSON:        false,
+		Debug:          false,
+		EnableAPI:      true,
+	})
 	suite.NotNil(server)
 	suite.Nil(err, "no error creating new server, logJson=false, debug=false, disabled=false")
 
-	server, err = NewServer(ServerOptions{backend, true, true, true, "", "", "", "", ""})
+	server, err = NewServer(ServerOptions{
+		StorageBackend: backend,
+		LogJSON:        true,
+		Debug:          true,
+		EnableAPI:      true,
+	})
 	suite.NotNil(server)
 	suite.Nil(err, "no error creating new server, logJson=true, debug=true, disabled=false")
 
-	server, err = NewServer(ServerOptions{backend, false, true, true, "", "", "", "user", "pass"})
-	suite.Nil(err, "no error creating new server, logJson=false, debug=true, disabled=false")
+	server, err = NewServer(ServerOptions{
+		StorageBackend:    backend,
+		LogJSON:           false,
+		Debug:             true,
+		EnableAPI:         true,
+		Username:          "user",
+		Password:          "pass",
+		PersistIndexCache: true,
+	})
+	suite.Nil(err, "no error creating new server, logJson=false, debug=true, disabled=false, persistIndexCache=true")
 
 	suite.Server = server
 
-	disabledAPIServer, err := NewServer(ServerOptions{backend, false, true, false, "", "", "", "", ""})
+	disabledAPIServer, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		LogJSON:        false,
+		Debug:          true,
+		EnableAPI:      false,
+	})
 	suite.Nil(err, "no error creating new server, logJson=false, debug=true, disabled=true")
 
 	suite.DisabledAPIServer = disabledAPIServer
@@ -104,7 +197,12 @@ func (suite *ServerTestSuite) SetupSuite() {
 	defer os.RemoveAll(suite.BrokenTempDirectory)
 
 	brokenBackend := storage.Backend(storage.NewLocalFilesystemBackend(suite.BrokenTempDirectory))
-	brokenServer, err := NewServer(ServerOptions{brokenBackend, false, true, true, "", "", "", "", ""})
+	brokenServer, err := NewServer(ServerOptions{
+		StorageBackend: brokenBackend,
+		LogJSON:        false,
+		Debug:          true,
+		EnableAPI:      true,
+	})
 	suite.Nil(err, "no error creating new server, logJson=false, debug=true")
 
 	suite.BrokenServer = brokenServer
@@ -143,6 +241,866 @@ func (suite *ServerTestSuite) TestRegenerateRepositoryIndex() {
 	suite.Nil(err, "error not returned with broken tarball removed")
 }
 
+func (suite *ServerTestSuite) TestIndexCache() {
+	err := suite.Server.regenerateRepositoryIndex()
+	suite.Nil(err, "no error regenerating repo index")
+
+	_, err = suite.Server.StorageBackend.GetObject(repo.IndexCacheFilename)
+	suite.Nil(err, "index cache persisted to storage")
+
+	var fetched int32
+	backend := countingBackend{suite.Server.StorageBackend, &fetched}
+	server, err := NewServer(ServerOptions{
+		StorageBackend:    backend,
+		EnableAPI:         true,
+		PersistIndexCache: true,
+	})
+	suite.Nil(err, "no error creating new server from persisted index cache")
+	suite.Equal(len(suite.Server.StorageCache), len(server.StorageCache), "storage cache loaded from index cache")
+	suite.Equal(len(suite.Server.RepositoryIndex().Entries), len(server.RepositoryIndex().Entries), "index loaded from index cache")
+	suite.Equal(int32(0), atomic.LoadInt32(&fetched), "unchanged chart packages not fetched from storage")
+
+	err = suite.Server.StorageBackend.PutObject(repo.IndexCacheFilename, []byte("this is not an index cache"))
+	suite.Nil(err, "no error overwriting index cache with bad content")
+	server, err = NewServer(ServerOptions{
+		StorageBackend:    backend,
+		EnableAPI:         true,
+		PersistIndexCache: true,
+	})
+	suite.Nil(err, "no error creating new server with invalid index cache")
+	suite.Equal(len(suite.Server.RepositoryIndex().Entries), len(server.RepositoryIndex().Entries), "index regenerated with invalid index cache")
+	suite.Equal(int32(len(suite.Server.StorageCache)), atomic.LoadInt32(&fetched), "all chart packages fetched from storage with invalid index cache")
+}
+
+func (suite *ServerTestSuite) TestIndexRefresher() {
+	tempDirectory := fmt.Sprintf("%s-refresher", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+	err = backend.PutObject("mychart-0.1.0.tgz", content)
+	suite.Nil(err, "no error putting test tarball in storage")
+
+	server, err := NewServer(ServerOptions{
+		StorageBackend:       backend,
+		EnableAPI:            true,
+		IndexRefreshInterval: time.Hour,
+	})
+	suite.Nil(err, "no error creating new server with background index refresher")
+	suite.NotNil(server.RepositoryIndex().Entries["mychart"], "chart in index after startup")
+
+	err = backend.DeleteObject("mychart-0.1.0.tgz")
+	suite.Nil(err, "no error deleting test tarball from storage")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/api/charts/mychart", nil)
+	server.Router.HandleContext(c)
+	suite.Equal(200, c.Writer.Status(), "200 GET /api/charts/mychart served from memory")
+
+	server.requestIndexRefresh()
+	for i := 0; i < 50 && server.RepositoryIndex().Entries["mychart"] != nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	suite.Nil(server.RepositoryIndex().Entries["mychart"], "chart removed from index after background refresh")
+}
+
+func (suite *ServerTestSuite) TestIncrementalIndexUpdate() {
+	tempDirectory := fmt.Sprintf("%s-incremental", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	// with a background refresher, storage is never listed on request, so changes must be applied directly
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	server, err := NewServer(ServerOptions{
+		StorageBackend:       backend,
+		EnableAPI:            true,
+		IndexRefreshInterval: time.Hour,
+	})
+	suite.Nil(err, "no error creating new server with background index refresher")
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("POST", "/api/charts", bytes.NewBuffer(content))
+	server.Router.HandleContext(c)
+	suite.Equal(201, c.Writer.Status(), "201 POST /api/charts")
+	suite.NotNil(server.RepositoryIndex().Entries["mychart"], "chart in index right after upload")
+	suite.Equal(1, len(server.StorageCache), "uploaded package in storage cache")
+	server.StorageCacheLock.Lock()
+	_, diff, err := server.listObjectsGetDiff()
+	server.StorageCacheLock.Unlock()
+	suite.Nil(err, "no error listing storage after upload")
+	suite.False(diff.Change, "uploaded package not seen as changed the next time storage is listed")
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("DELETE", "/api/charts/mychart/0.1.0", nil)
+	server.Router.HandleContext(c)
+	suite.Equal(200, c.Writer.Status(), "200 DELETE /api/charts/mychart/0.1.0")
+	suite.Nil(server.RepositoryIndex().Entries["mychart"], "chart removed from index right after delete")
+	suite.Equal(0, len(server.StorageCache), "deleted package removed from storage cache")
+}
+
+func (suite *ServerTestSuite) TestOverwrite() {
+	tempDirectory := fmt.Sprintf("%s-overwrite", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	server, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		EnableAPI:      true,
+		AllowOverwrite: true,
+	})
+	suite.Nil(err, "no error creating new server with overwrite allowed")
+
+	doRequest := func(method string, urlStr string, content []byte) int {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest(method, urlStr, bytes.NewBuffer(content))
+		server.Router.HandleContext(c)
+		return c.Writer.Status()
+	}
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+	provContent, err := ioutil.ReadFile(testProvfilePath)
+	suite.Nil(err, "no error opening test provenance file")
+
+	suite.Equal(201, doRequest("POST", "/api/charts", content), "201 POST /api/charts")
+	suite.Equal(201, doRequest("POST", "/api/prov", provContent), "201 POST /api/prov")
+	suite.Equal(409, doRequest("POST", "/api/charts", content), "409 POST /api/charts without force")
+	suite.Equal(409, doRequest("POST", "/api/prov", provContent), "409 POST /api/prov without force")
+
+	suite.Equal(201, doRequest("POST", "/api/charts?force", content), "201 POST /api/charts?force")
+	suite.Equal(1, len(server.RepositoryIndex().Entries["mychart"]), "overwritten chart version updated in index")
+	_, err = backend.GetObject("mychart-0.1.0.tgz.prov")
+	suite.NotNil(err, "stale provenance file removed on overwrite")
+
+	suite.Equal(201, doRequest("POST", "/api/prov?force", provContent), "201 POST /api/prov?force")
+	suite.Equal(201, doRequest("POST", "/api/prov?force", provContent), "201 POST /api/prov?force again")
+}
+
+func (suite *ServerTestSuite) TestLintOnUpload() {
+	tempDirectory := fmt.Sprintf("%s-lint", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	_, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		LintOnUpload:   true,
+		LintSeverity:   "fatal",
+	})
+	suite.Equal(repo.ErrorInvalidLintSeverity, err, "error creating new server with unknown lint severity")
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+
+	for _, test := range []struct {
+		severity string
+		status   int
+	}{
+		{"info", 400},
+		{"error", 201},
+	} {
+		server, err := NewServer(ServerOptions{
+			StorageBackend: backend,
+			EnableAPI:      true,
+			LintOnUpload:   true,
+			LintSeverity:   test.severity,
+		})
+		suite.Nil(err, fmt.Sprintf("no error creating new server with lint severity %s", test.severity))
+
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request, _ = http.NewRequest("POST", "/api/charts", bytes.NewBuffer(content))
+		server.Router.HandleContext(c)
+		suite.Equal(test.status, c.Writer.Status(), fmt.Sprintf("%d POST /api/charts with lint severity %s", test.status, test.severity))
+		if test.status == 400 {
+			suite.Contains(recorder.Body.String(), "lint_failed", "lint error code in response")
+			suite.Contains(recorder.Body.String(), "icon is recommended", "lint messages in response")
+		}
+	}
+}
+
+func (suite *ServerTestSuite) TestProvenanceVerification() {
+	tempDirectory := fmt.Sprintf("%s-verify", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	_, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		Keyring:        "../../testdata/pgp/missing.pub",
+	})
+	suite.NotNil(err, "error creating new server with missing keyring")
+
+	_, doRequest := suite.newTestServer(ServerOptions{
+		StorageBackend: backend,
+		EnableAPI:      true,
+		Keyring:        testKeyringPath,
+	})
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+	provContent, err := ioutil.ReadFile(testProvfilePath)
+	suite.Nil(err, "no error opening test provenance file")
+	tamperedProvContent := bytes.Replace(provContent, []byte("files:"), []byte("description: tampered\nfiles:"), 1)
+
+	suite.Equal(422, doRequest("POST", "/api/prov", provContent, nil).Code, "422 POST /api/prov before chart package")
+	suite.Equal(201, doRequest("POST", "/api/charts", content, nil).Code, "201 POST /api/charts")
+	suite.Equal(422, doRequest("POST", "/api/prov", tamperedProvContent, nil).Code, "422 POST /api/prov with tampered provenance file")
+	suite.Equal(201, doRequest("POST", "/api/prov", provContent, nil).Code, "201 POST /api/prov")
+
+	// names of maintainers come before the chart name in provenance files
+	content, err = ioutil.ReadFile(testMaintainersTarballPath)
+	suite.Nil(err, "no error opening test tarball with maintainers")
+	provContent, err = ioutil.ReadFile(testMaintainersProvfilePath)
+	suite.Nil(err, "no error opening test provenance file with maintainers")
+	suite.Equal(201, doRequest("POST", "/api/charts", content, nil).Code, "201 POST /api/charts with maintainers")
+	suite.Equal(201, doRequest("POST", "/api/prov", provContent, nil).Code, "201 POST /api/prov with maintainers")
+	_, err = os.Stat(pathutil.Join(tempDirectory, "otherchart-0.2.0.tgz.prov"))
+	suite.Nil(err, "provenance file with maintainers stored under chart name")
+}
+
+func (suite *ServerTestSuite) TestRequireProvenance() {
+	tempDirectory := fmt.Sprintf("%s-require-provenance", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	_, err := NewServer(ServerOptions{
+		StorageBackend:    backend,
+		RequireProvenance: true,
+	})
+	suite.NotNil(err, "error creating new server requiring provenance without keyring")
+
+	_, err = NewServer(ServerOptions{
+		StorageBackend:    backend,
+		Keyring:           testKeyringPath,
+		RequireProvenance: true,
+		ProxyUpstreams:    []string{"http://localhost:8080"},
+	})
+	suite.NotNil(err, "error creating new server requiring provenance with upstream repositories")
+
+	_, doRequest := suite.newTestServer(ServerOptions{
+		StorageBackend:    backend,
+		EnableAPI:         true,
+		Keyring:           testKeyringPath,
+		RequireProvenance: true,
+	})
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+	provContent, err := ioutil.ReadFile(testProvfilePath)
+	suite.Nil(err, "no error opening test provenance file")
+
+	suite.Equal(201, doRequest("POST", "/api/charts", content, nil).Code, "201 POST /api/charts")
+	suite.Equal(404, doRequest("GET", "/api/charts/mychart", nil, nil).Code, "404 GET /api/charts/mychart before signing")
+	suite.NotContains(doRequest("GET", "/index.yaml", nil, nil).Body.String(), "mychart", "unsigned chart not in index")
+	res := doRequest("GET", "/api/pending", nil, nil)
+	suite.Equal(200, res.Code, "200 GET /api/pending")
+	suite.Contains(res.Body.String(), "mychart-0.1.0.tgz", "unsigned chart pending")
+	suite.Contains(res.Body.String(), "no provenance file", "reason chart is pending")
+
+	suite.Equal(201, doRequest("POST", "/api/prov", provContent, nil).Code, "201 POST /api/prov")
+	suite.Equal(200, doRequest("GET", "/api/charts/mychart", nil, nil).Code, "200 GET /api/charts/mychart once signed")
+	suite.Contains(doRequest("GET", "/index.yaml", nil, nil).Body.String(), "mychart", "signed chart in index")
+	suite.Equal("[]", doRequest("GET", "/api/pending", nil, nil).Body.String(), "no pending chart once signed")
+
+	err = backend.DeleteObject("mychart-0.1.0.tgz.prov")
+	suite.Nil(err, "no error deleting provenance file from storage")
+	suite.Equal(404, doRequest("GET", "/api/charts/mychart", nil, nil).Code, "404 GET /api/charts/mychart once provenance file deleted")
+
+	err = backend.PutObject("mychart-0.1.0.tgz.prov", provContent)
+	suite.Nil(err, "no error saving provenance file to storage")
+	suite.Equal(200, doRequest("GET", "/api/charts/mychart", nil, nil).Code, "200 GET /api/charts/mychart with provenance file added to storage")
+}
+
+func (suite *ServerTestSuite) TestSigning() {
+	tempDirectory := fmt.Sprintf("%s-signing", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	_, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		SigningKeyring: testSigningKeyringPath,
+	})
+	suite.NotNil(err, "error creating new server with signing keyring but no signing key")
+
+	_, err = NewServer(ServerOptions{
+		StorageBackend: backend,
+		SigningKeyring: testSigningKeyringPath,
+		SigningKey:     "nobody@example.com",
+	})
+	suite.NotNil(err, "error creating new server with unknown signing key")
+
+	otherKeyringPath := pathutil.Join(tempDirectory, "other-keyring.pub")
+	otherEntity, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	suite.Nil(err, "no error generating other key")
+	otherKeyring, err := os.Create(otherKeyringPath)
+	suite.Nil(err, "no error creating other keyring")
+	suite.Nil(otherEntity.Serialize(otherKeyring), "no error writing other keyring")
+	otherKeyring.Close()
+	_, err = NewServer(ServerOptions{
+		StorageBackend:    backend,
+		Keyring:           otherKeyringPath,
+		RequireProvenance: true,
+		SigningKeyring:    testSigningKeyringPath,
+		SigningKey:        "helm-test",
+	})
+	suite.NotNil(err, "error creating new server requiring provenance with signing key not in keyring")
+
+	_, doRequest := suite.newTestServer(ServerOptions{
+		StorageBackend:    backend,
+		EnableAPI:         true,
+		Keyring:           testKeyringPath,
+		RequireProvenance: true,
+		SigningKeyring:    testSigningKeyringPath,
+		SigningKey:        "helm-test",
+	})
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+
+	suite.Equal(201, doRequest("POST", "/api/charts", content, nil).Code, "201 POST /api/charts")
+	provObject, err := backend.GetObject("mychart-0.1.0.tgz.prov")
+	suite.Nil(err, "provenance file generated on upload")
+	suite.Equal(200, doRequest("GET", "/api/charts/mychart/0.1.0", nil, nil).Code, "200 GET /api/charts/mychart/0.1.0 signed on upload")
+	suite.Equal(200, doRequest("GET", "/charts/mychart-0.1.0.tgz.prov", nil, nil).Code, "200 GET /charts/mychart-0.1.0.tgz.prov")
+
+	signatory, err := provenance.NewFromKeyring(testKeyringPath, "")
+	suite.Nil(err, "no error loading test keyring")
+	err = repo.VerifyProvenanceFile(signatory, provObject.Content, "mychart-0.1.0.tgz", content)
+	suite.Nil(err, "generated provenance file verified")
+}
+
+func (suite *ServerTestSuite) TestMultipartUpload() {
+	tempDirectory := fmt.Sprintf("%s-multipart", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+	provContent, err := ioutil.ReadFile(testProvfilePath)
+	suite.Nil(err, "no error opening test provenance file")
+	maintainersContent, err := ioutil.ReadFile(testMaintainersTarballPath)
+	suite.Nil(err, "no error opening test tarball with maintainers")
+	maintainersProvContent, err := ioutil.ReadFile(testMaintainersProvfilePath)
+	suite.Nil(err, "no error opening test provenance file with maintainers")
+
+	multipartBody := func(parts map[string][]byte) ([]byte, http.Header) {
+		body := bytes.NewBuffer([]byte{})
+		writer := multipart.NewWriter(body)
+		for field, partContent := range parts {
+			part, err := writer.CreateFormFile(field, field)
+			suite.Nil(err, "no error creating multipart part")
+			_, err = part.Write(partContent)
+			suite.Nil(err, "no error writing multipart part")
+		}
+		suite.Nil(writer.Close(), "no error closing multipart writer")
+		return body.Bytes(), http.Header{"Content-Type": {writer.FormDataContentType()}}
+	}
+
+	for _, test := range []struct {
+		backend storage.Backend
+		status  int
+		stored  bool
+	}{
+		{provFailingBackend{storage.NewLocalFilesystemBackend(tempDirectory)}, 503, false},
+		{storage.NewLocalFilesystemBackend(tempDirectory), 201, true},
+	} {
+		server, doRequest := suite.newTestServer(ServerOptions{
+			StorageBackend: test.backend,
+			EnableAPI:      true,
+			Keyring:        testKeyringPath,
+		})
+		doUpload := func(parts map[string][]byte) int {
+			body, header := multipartBody(parts)
+			return doRequest("POST", "/api/charts", body, header).Code
+		}
+
+		suite.Equal(400, doUpload(map[string][]byte{"chart": content}), "400 POST /api/charts without prov part")
+		mismatchedProvContent := bytes.Replace(provContent, []byte("version: 0.1.0"), []byte("version: 0.2.0"), 1)
+		suite.Equal(422, doUpload(map[string][]byte{"chart": content, "prov": mismatchedProvContent}),
+			"422 POST /api/charts with provenance file for another chart version")
+		suite.Equal(422, doUpload(map[string][]byte{"chart": append(content, 0), "prov": provContent}),
+			"422 POST /api/charts with provenance file for another chart package")
+
+		suite.Equal(test.status, doUpload(map[string][]byte{"chart": content, "prov": provContent}),
+			fmt.Sprintf("%d POST /api/charts with chart and prov parts", test.status))
+		_, err := os.Stat(pathutil.Join(tempDirectory, "mychart-0.1.0.tgz"))
+		suite.Equal(test.stored, err == nil, "chart package stored with its provenance file, or not at all")
+		_, err = os.Stat(pathutil.Join(tempDirectory, "mychart-0.1.0.tgz.prov"))
+		suite.Equal(test.stored, err == nil, "provenance file stored with its chart package, or not at all")
+		suite.Equal(test.stored, server.RepositoryIndex().Has("mychart", "0.1.0"), "chart version published with its provenance file")
+
+		// names of maintainers come before the chart name in provenance files
+		suite.Equal(test.status, doUpload(map[string][]byte{"chart": maintainersContent, "prov": maintainersProvContent}),
+			fmt.Sprintf("%d POST /api/charts with chart and prov parts of chart with maintainers", test.status))
+		suite.Equal(test.stored, server.RepositoryIndex().Has("otherchart", "0.2.0"), "chart version with maintainers published with its provenance file")
+	}
+}
+
+func (suite *ServerTestSuite) TestTokenAuth() {
+	tempDirectory := fmt.Sprintf("%s-token-auth", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+
+	tokenFile := pathutil.Join(tempDirectory, "tokens.yaml")
+	err := ioutil.WriteFile(tokenFile, []byte(`
+- name: readonly
+  token: pull-token
+  scopes: [pull]
+- name: ci
+  token: push-token
+  scopes: [pull, push]
+- name: admin
+  token: delete-token
+  scopes: [delete]
+`), 0644)
+	suite.Nil(err, "no error writing token file")
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	suite.Nil(err, "no error generating jwt key")
+	otherPrivateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	suite.Nil(err, "no error generating other jwt key")
+	publicKeyContent, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	suite.Nil(err, "no error marshaling jwt public key")
+	publicKeyFile := pathutil.Join(tempDirectory, "jwt.pub")
+	err = ioutil.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyContent}), 0644)
+	suite.Nil(err, "no error writing jwt public key")
+
+	signJWT := func(key *rsa.PrivateKey, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		suite.Nil(err, "no error signing jwt")
+		return token
+	}
+
+	invalidTokenFile := pathutil.Join(tempDirectory, "invalid-tokens.yaml")
+	err = ioutil.WriteFile(invalidTokenFile, []byte("- token: t\n  scopes: [admin]\n"), 0644)
+	suite.Nil(err, "no error writing invalid token file")
+	_, err = NewServer(ServerOptions{StorageBackend: backend, AuthTokenFile: invalidTokenFile})
+	suite.NotNil(err, "error creating new server with unknown scope in token file")
+
+	_, doRequest := suite.newTestServer(ServerOptions{
+		StorageBackend:   backend,
+		EnableAPI:        true,
+		Username:         "user",
+		Password:         "pass",
+		AuthTokenFile:    tokenFile,
+		AuthJWTPublicKey: publicKeyFile,
+	})
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+
+	doAuthorizedRequest := func(method string, urlStr string, authorization string) *httptest.ResponseRecorder {
+		header := http.Header{}
+		if authorization != "" {
+			header.Set("Authorization", authorization)
+		}
+		return doRequest(method, urlStr, content, header)
+	}
+
+	res := doAuthorizedRequest("GET", "/index.yaml", "")
+	suite.Equal(401, res.Code, "401 GET /index.yaml without credentials")
+	suite.Equal([]string{`Basic realm="ChartMuseum"`, `Bearer realm="ChartMuseum"`}, res.Header()["Www-Authenticate"],
+		"authentication schemes in WWW-Authenticate headers")
+
+	suite.Equal(401, doAuthorizedRequest("GET", "/index.yaml", "Bearer unknown-token").Code, "401 GET /index.yaml with unknown token")
+	suite.Equal(200, doAuthorizedRequest("GET", "/index.yaml", "Bearer pull-token").Code, "200 GET /index.yaml with pull token")
+	suite.Equal(403, doAuthorizedRequest("POST", "/api/charts", "Bearer pull-token").Code, "403 POST /api/charts with pull token")
+	suite.Equal(201, doAuthorizedRequest("POST", "/api/charts", "Bearer push-token").Code, "201 POST /api/charts with push token")
+	suite.Equal(403, doAuthorizedRequest("DELETE", "/api/charts/mychart/0.1.0", "Bearer push-token").Code, "403 DELETE /api/charts/mychart/0.1.0 with push token")
+	suite.Equal(403, doAuthorizedRequest("GET", "/api/charts", "Bearer delete-token").Code, "403 GET /api/charts with delete token")
+	suite.Equal(200, doAuthorizedRequest("DELETE", "/api/charts/mychart/0.1.0", "Bearer delete-token").Code, "200 DELETE /api/charts/mychart/0.1.0 with delete token")
+
+	suite.Equal(201, doAuthorizedRequest("POST", "/api/charts", basicAuthorization("user", "pass")).Code, "201 POST /api/charts with basic auth")
+
+	expires := time.Now().Add(time.Hour).Unix()
+	token := signJWT(privateKey, jwt.MapClaims{"scope": "pull", "exp": expires})
+	suite.Equal(200, doAuthorizedRequest("GET", "/api/charts", "Bearer "+token).Code, "200 GET /api/charts with pull jwt")
+	suite.Equal(403, doAuthorizedRequest("DELETE", "/api/charts/mychart/0.1.0", "Bearer "+token).Code, "403 DELETE /api/charts/mychart/0.1.0 with pull jwt")
+
+	token = signJWT(privateKey, jwt.MapClaims{"scopes": []string{"pull", "delete"}, "exp": expires})
+	suite.Equal(200, doAuthorizedRequest("DELETE", "/api/charts/mychart/0.1.0", "Bearer "+token).Code, "200 DELETE /api/charts/mychart/0.1.0 with delete jwt")
+
+	token = signJWT(privateKey, jwt.MapClaims{"scope": "pull", "exp": time.Now().Add(-time.Hour).Unix()})
+	suite.Equal(401, doAuthorizedRequest("GET", "/api/charts", "Bearer "+token).Code, "401 GET /api/charts with expired jwt")
+
+	token = signJWT(otherPrivateKey, jwt.MapClaims{"scope": "pull", "exp": expires})
+	suite.Equal(401, doAuthorizedRequest("GET", "/api/charts", "Bearer "+token).Code, "401 GET /api/charts with jwt signed by another key")
+
+	suite.Equal(200, doAuthorizedRequest("GET", "/health", "").Code, "200 GET /health without credentials")
+}
+
+func (suite *ServerTestSuite) TestAnonymousGet() {
+	tempDirectory := fmt.Sprintf("%s-anonymous-get", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+
+	_, doRequest := suite.newTestServer(ServerOptions{
+		StorageBackend:   backend,
+		EnableAPI:        true,
+		Username:         "user",
+		Password:         "pass",
+		AuthAnonymousGet: true,
+		EnableMetrics:    true,
+	})
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+
+	doAuthorizedRequest := func(method string, urlStr string, password string) *httptest.ResponseRecorder {
+		header := http.Header{}
+		if password != "" {
+			header.Set("Authorization", basicAuthorization("user", password))
+		}
+		return doRequest(method, urlStr, content, header)
+	}
+
+	suite.Equal(401, doAuthorizedRequest("POST", "/api/charts", "").Code, "401 POST /api/charts without credentials")
+	suite.Equal(201, doAuthorizedRequest("POST", "/api/charts", "pass").Code, "201 POST /api/charts with credentials")
+
+	suite.Equal(200, doAuthorizedRequest("GET", "/index.yaml", "").Code, "200 GET /index.yaml without credentials")
+	suite.Equal(200, doAuthorizedRequest("GET", "/charts/mychart-0.1.0.tgz", "").Code, "200 GET /charts/mychart-0.1.0.tgz without credentials")
+	suite.Equal(200, doAuthorizedRequest("GET", "/api/charts/mychart/0.1.0", "").Code, "200 GET /api/charts/mychart/0.1.0 without credentials")
+	suite.Equal(401, doAuthorizedRequest("GET", "/index.yaml", "wrong").Code, "401 GET /index.yaml with invalid credentials")
+	suite.Equal(401, doAuthorizedRequest("POST", "/api/charts/mychart/0.1.0/render", "").Code, "401 POST /api/charts/mychart/0.1.0/render without credentials")
+	suite.Equal(401, doAuthorizedRequest("GET", "/metrics", "").Code, "401 GET /metrics without credentials")
+	suite.Equal(200, doAuthorizedRequest("GET", "/metrics", "pass").Code, "200 GET /metrics with credentials")
+
+	suite.Equal(401, doAuthorizedRequest("DELETE", "/api/charts/mychart/0.1.0", "").Code, "401 DELETE /api/charts/mychart/0.1.0 without credentials")
+	suite.Equal(200, doAuthorizedRequest("DELETE", "/api/charts/mychart/0.1.0", "pass").Code, "200 DELETE /api/charts/mychart/0.1.0 with credentials")
+}
+
+func (suite *ServerTestSuite) TestMetrics() {
+	server, err := NewServer(ServerOptions{
+		StorageBackend: suite.Server.StorageBackend,
+		EnableAPI:      true,
+		EnableMetrics:  true,
+	})
+	suite.Nil(err, "no error creating new server with metrics enabled")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/index.yaml", nil)
+	server.Router.HandleContext(c)
+	suite.Equal(200, c.Writer.Status(), "200 GET /index.yaml")
+
+	recorder := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(recorder)
+	c.Request, _ = http.NewRequest("GET", "/metrics", nil)
+	server.Router.HandleContext(c)
+	suite.Equal(200, c.Writer.Status(), "200 GET /metrics")
+
+	body := recorder.Body.String()
+	expected := []string{
+		`chartmuseum_http_requests_total{method="GET",route="/index.yaml",status="200"} 1`,
+		"chartmuseum_index_regeneration_duration_seconds_count",
+		"chartmuseum_chart_versions",
+		`chartmuseum_storage_operation_duration_seconds_count{operation="ListObjects"}`,
+	}
+	for _, metric := range expected {
+		suite.Contains(body, metric, fmt.Sprintf("%s exposed in /metrics", metric))
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/metrics", nil)
+	suite.DisabledAPIServer.Router.HandleContext(c)
+	suite.Equal(404, c.Writer.Status(), "404 GET /metrics with metrics disabled")
+}
+
+func (suite *ServerTestSuite) TestProbes() {
+	doRequest := func(server *Server, urlStr string) int {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", urlStr, nil)
+		server.Router.HandleContext(c)
+		return c.Writer.Status()
+	}
+
+	// no credentials given, only the probes are served
+	suite.Equal(200, doRequest(suite.Server, "/health"), "200 GET /health without basic auth")
+	suite.Equal(200, doRequest(suite.Server, "/ready"), "200 GET /ready without basic auth")
+	suite.Equal(401, doRequest(suite.Server, "/index.yaml"), "401 GET /index.yaml without basic auth")
+
+	server, err := NewServer(ServerOptions{
+		StorageBackend:       suite.Server.StorageBackend,
+		IndexRefreshInterval: time.Hour,
+	})
+	suite.Nil(err, "no error creating new server with background index refresher")
+	suite.Equal(200, doRequest(server, "/ready"), "200 GET /ready after startup")
+
+	server.setIndexSyncStatus(fmt.Errorf("storage unreachable"))
+	suite.Equal(503, doRequest(server, "/ready"), "503 GET /ready after failed background refresh")
+	suite.Equal(200, doRequest(server, "/health"), "200 GET /health after failed background refresh")
+
+	server.setIndexSyncStatus(nil)
+	server.lastIndexSync = time.Now().Add(-4 * time.Hour)
+	suite.Equal(503, doRequest(server, "/ready"), "503 GET /ready with stale index")
+}
+
+func (suite *ServerTestSuite) TestNestedRepositories() {
+	tempDirectory := fmt.Sprintf("%s-nested", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	server, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		EnableAPI:      true,
+		ChartURL:       "http://localhost:8080",
+		Depth:          2,
+	})
+	suite.Nil(err, "no error creating new server with nested repositories")
+
+	doRequest := func(method string, urlStr string, body io.Reader) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request, _ = http.NewRequest(method, urlStr, body)
+		server.Router.HandleContext(c)
+		return recorder
+	}
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+
+	res := doRequest("POST", "/api/org1/repo1/charts", bytes.NewBuffer(content))
+	suite.Equal(201, res.Code, "201 POST /api/org1/repo1/charts")
+	_, err = os.Stat(pathutil.Join(tempDirectory, "org1", "repo1", "mychart-0.1.0.tgz"))
+	suite.Nil(err, "package stored under repository prefix")
+
+	res = doRequest("GET", "/org1/repo1/index.yaml", nil)
+	suite.Equal(200, res.Code, "200 GET /org1/repo1/index.yaml")
+	suite.Contains(res.Body.String(), "http://localhost:8080/org1/repo1/charts/mychart-0.1.0.tgz", "chart url includes repository")
+
+	res = doRequest("GET", "/org1/repo2/index.yaml", nil)
+	suite.Equal(404, res.Code, "404 GET /org1/repo2/index.yaml for repository not in storage")
+	_, err = os.Stat(pathutil.Join(tempDirectory, "org1", "repo2"))
+	suite.True(os.IsNotExist(err), "no directory created for repository not in storage")
+	suite.Equal(1, len(server.loadedRepositories()), "repository not in storage not loaded")
+
+	err = os.MkdirAll(pathutil.Join(tempDirectory, "org2", "repo1"), 0777)
+	suite.Nil(err, "no error creating repository directory")
+	err = ioutil.WriteFile(pathutil.Join(tempDirectory, "org2", "repo1", "README.md"), []byte("repo1"), 0644)
+	suite.Nil(err, "no error writing file to repository")
+	res = doRequest("GET", "/org2/repo1/index.yaml", nil)
+	suite.Equal(200, res.Code, "200 GET /org2/repo1/index.yaml for repository in storage")
+	suite.NotContains(res.Body.String(), "mychart", "chart not in other repository")
+	suite.Equal(2, len(server.loadedRepositories()), "repository in storage loaded")
+
+	res = doRequest("GET", "/org1/repo1/charts/mychart-0.1.0.tgz", nil)
+	suite.Equal(200, res.Code, "200 GET /org1/repo1/charts/mychart-0.1.0.tgz")
+
+	res = doRequest("GET", "/org1/repo2/charts/mychart-0.1.0.tgz", nil)
+	suite.Equal(404, res.Code, "404 GET /org1/repo2/charts/mychart-0.1.0.tgz")
+
+	res = doRequest("GET", "/api/org1/repo1/charts/mychart/0.1.0", nil)
+	suite.Equal(200, res.Code, "200 GET /api/org1/repo1/charts/mychart/0.1.0")
+
+	res = doRequest("GET", "/api/org1/repo2/charts/mychart", nil)
+	suite.Equal(404, res.Code, "404 GET /api/org1/repo2/charts/mychart")
+
+	res = doRequest("GET", "/org1/.repo/index.yaml", nil)
+	suite.Equal(400, res.Code, "400 GET /org1/.repo/index.yaml")
+
+	res = doRequest("GET", "/index.yaml", nil)
+	suite.Equal(404, res.Code, "404 GET /index.yaml with nested repositories")
+
+	res = doRequest("GET", "/health", nil)
+	suite.Equal(200, res.Code, "200 GET /health with nested repositories")
+
+	res = doRequest("GET", "/ready", nil)
+	suite.Equal(200, res.Code, "200 GET /ready with nested repositories")
+}
+
+func (suite *ServerTestSuite) TestProxy() {
+	tempDirectory := fmt.Sprintf("%s-proxy", suite.TempDirectory)
+	defer os.RemoveAll(tempDirectory)
+
+	content, err := ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error opening test tarball")
+
+	upstreamIndex := repo.NewIndex("")
+	chartVersion, err := repo.ChartVersionFromStorageObject(storage.Object{
+		Path:         "mychart-0.1.0.tgz",
+		Content:      content,
+		LastModified: time.Now(),
+	})
+	suite.Nil(err, "no error creating upstream chart version")
+	upstreamIndex.AddEntry(chartVersion)
+	missingChartVersion := *chartVersion
+	missingMetadata := *chartVersion.Metadata
+	missingMetadata.Version = "0.2.0"
+	missingChartVersion.Metadata = &missingMetadata
+	missingChartVersion.URLs = []string{"charts/mychart-0.2.0.tgz"}
+	upstreamIndex.AddEntry(&missingChartVersion)
+	err = upstreamIndex.Regenerate()
+	suite.Nil(err, "no error regenerating upstream index")
+
+	packageRequests := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			w.Write(upstreamIndex.Raw)
+		case "/charts/mychart-0.1.0.tgz":
+			packageRequests++
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	backend := storage.Backend(storage.NewLocalFilesystemBackend(tempDirectory))
+	server, err := NewServer(ServerOptions{
+		StorageBackend: backend,
+		EnableAPI:      true,
+		ProxyUpstreams: []string{upstream.URL},
+	})
+	suite.Nil(err, "no error creating new server with upstream repository")
+
+	doRequest := func(method string, urlStr string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request, _ = http.NewRequest(method, urlStr, nil)
+		server.Router.HandleContext(c)
+		return recorder
+	}
+
+	res := doRequest("GET", "/index.yaml")
+	suite.Equal(200, res.Code, "200 GET /index.yaml")
+	suite.Contains(res.Body.String(), "charts/mychart-0.1.0.tgz", "upstream chart version in served index")
+	suite.Contains(res.Body.String(), "charts/mychart-0.2.0.tgz", "all upstream chart versions in served index")
+	suite.False(server.RepositoryIndex().Has("mychart", "0.1.0"), "upstream chart version not in local index before pull")
+
+	res = doRequest("GET", "/api/charts/mychart/0.1.0")
+	suite.Equal(200, res.Code, "200 GET /api/charts/mychart/0.1.0")
+
+	res = doRequest("GET", "/charts/mychart-0.1.0.tgz")
+	suite.Equal(200, res.Code, "200 GET /charts/mychart-0.1.0.tgz pulled from upstream")
+	suite.Equal(content, res.Body.Bytes(), "package content pulled from upstream")
+	suite.Equal(1, packageRequests, "package requested from upstream")
+	_, err = os.Stat(pathutil.Join(tempDirectory, "mychart-0.1.0.tgz"))
+	suite.Nil(err, "package pulled from upstream saved to storage")
+	suite.True(server.RepositoryIndex().Has("mychart", "0.1.0"), "package pulled from upstream added to local index")
+
+	res = doRequest("GET", "/charts/mychart-0.1.0.tgz")
+	suite.Equal(200, res.Code, "200 GET /charts/mychart-0.1.0.tgz from storage")
+	suite.Equal(1, packageRequests, "package served from storage once pulled")
+
+	res = doRequest("GET", "/charts/mychart-0.2.0.tgz")
+	suite.Equal(404, res.Code, "404 GET /charts/mychart-0.2.0.tgz missing upstream")
+
+	res = doRequest("GET", "/charts/otherchart-0.1.0.tgz")
+	suite.Equal(404, res.Code, "404 GET /charts/otherchart-0.1.0.tgz not in any index")
+
+	upstream.Close()
+	res = doRequest("GET", "/charts/mychart-0.2.0.tgz.prov")
+	suite.Equal(502, res.Code, "502 GET /charts/mychart-0.2.0.tgz.prov with upstream down")
+}
+
+func (suite *ServerTestSuite) TestErrorStatusCode() {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{storage.ErrorObjectNotFound, 404, "not_found"},
+		{repo.ErrorChartNotFound, 404, "not_found"},
+		{storage.ErrorObjectAlreadyExists, 409, "already_exists"},
+		{repo.ErrorInvalidChartPackage, 400, "invalid_package"},
+		{repo.ErrorInvalidProvenanceFile, 422, "invalid_provenance"},
+		{errorInvalidPagination, 400, "invalid_parameter"},
+		{repo.ErrorInvalidVersionConstraint, 400, "invalid_parameter"},
+		{errorInvalidSort, 400, "invalid_parameter"},
+		{errorInvalidFormat, 400, "invalid_parameter"},
+		{errorFileNotFoundInChart, 404, "not_found"},
+		{errorInvalidRenderRequest, 400, "invalid_request"},
+		{errorInvalidMultipartUpload, 400, "invalid_request"},
+		{errorProvenanceMismatch, 422, "verification_failed"},
+		{&repo.ProvenanceVerificationError{Err: fmt.Errorf("sha256 sum does not match")}, 422, "verification_failed"},
+		{&repo.LintError{Messages: []string{"[ERROR] Chart.yaml: version is required"}}, 400, "lint_failed"},
+		{&renderError{fmt.Errorf("template error")}, 422, "render_failed"},
+		{&storage.BackendUnavailableError{Err: fmt.Errorf("timeout")}, 503, "backend_unavailable"},
+		{repo.ErrorRemoteFileNotFound, 404, "not_found"},
+		{&repo.RemoteRepositoryError{URL: "http://upstream", Err: fmt.Errorf("timeout")}, 502, "upstream_unavailable"},
+		{errorUnauthorized, 401, "unauthorized"},
+		{errorInsufficientScope, 403, "forbidden"},
+		{fmt.Errorf("unexpected"), 500, "internal_error"},
+	}
+	for _, test := range tests {
+		status, code := errorStatusCode(test.err)
+		suite.Equal(test.status, status, fmt.Sprintf("status code for error %q", test.err))
+		suite.Equal(test.code, code, fmt.Sprintf("error code for error %q", test.err))
+	}
+}
+
+func (suite *ServerTestSuite) TestSortChartVersions() {
+	now := time.Now()
+	chartVersions := []*helm_repo.ChartVersion{
+		{Metadata: &helm_chart.Metadata{Name: "b", Version: "1.10.0"}, Created: now.Add(-time.Hour)},
+		{Metadata: &helm_chart.Metadata{Name: "a", Version: "1.2.0"}, Created: now},
+		{Metadata: &helm_chart.Metadata{Name: "c", Version: "1.9.0"}, Created: now.Add(-2 * time.Hour)},
+	}
+	names := func(chartVersions []*helm_repo.ChartVersion) []string {
+		result := []string{}
+		for _, chartVersion := range chartVersions {
+			result = append(result, chartVersion.Name)
+		}
+		return result
+	}
+
+	suite.Equal([]string{"a", "b", "c"}, names(sortChartVersions(chartVersions, "name", false)), "sorted by name")
+	suite.Equal([]string{"c", "b", "a"}, names(sortChartVersions(chartVersions, "name", true)), "sorted by name, descending")
+	suite.Equal([]string{"a", "b", "c"}, names(sortChartVersions(chartVersions, "created", true)), "sorted by created, newest first")
+	suite.Equal([]string{"b", "c", "a"}, names(sortChartVersions(chartVersions, "version", true)), "sorted by semver, highest first")
+	suite.Equal([]string{"b", "a", "c"}, names(chartVersions), "original order kept")
+
+	selected, err := selectFields(chartVersions[:1], []string{"name", "version", "unknown"})
+	suite.Nil(err, "no error selecting fields")
+	suite.Equal([]map[string]interface{}{{"name": "b", "version": "1.10.0"}}, selected, "only selected fields")
+
+	content, err := json.Marshal(chartsResponse{
+		names:  []string{"b", "a"},
+		charts: map[string]interface{}{"a": 1, "b": 2},
+	})
+	suite.Nil(err, "no error serializing charts response")
+	suite.Equal(`{"b":2,"a":1}`, string(content), "charts serialized in sort order")
+}
+
+func (suite *ServerTestSuite) TestPaginate() {
+	chartVersions := []*helm_repo.ChartVersion{{}, {}, {}}
+	suite.Equal(3, len(paginate(chartVersions, 0, 0)), "no limit")
+	suite.Equal(2, len(paginate(chartVersions, 1, 0)), "offset without limit")
+	suite.Equal(1, len(paginate(chartVersions, 1, 1)), "offset and limit")
+	suite.Equal(3, len(paginate(chartVersions, 0, 10)), "limit larger than results")
+	suite.Equal(0, len(paginate(chartVersions, 5, 1)), "offset larger than results")
+}
+
+func (suite *ServerTestSuite) TestRenderChart() {
+	chart := &helm_chart.Chart{
+		Metadata: &helm_chart.Metadata{Name: "mychart", Version: "0.1.0"},
+		Templates: []*helm_chart.Template{
+			{Name: "templates/_helpers.tpl", Data: []byte(`{{- define "mychart.fullname" -}}{{ .Release.Name }}-{{ .Chart.Name }}{{- end -}}`)},
+			{Name: "templates/pod.yaml", Data: []byte("name: {{ template \"mychart.fullname\" . }}\nimage: {{ .Values.image }}\n")},
+			{Name: "templates/disabled.yaml", Data: []byte("{{- if .Values.enabled }}\nenabled: true\n{{- end }}\n")},
+			{Name: "templates/NOTES.txt", Data: []byte("Installed {{ .Release.Name }}\n")},
+		},
+		Values: &helm_chart.Config{Raw: "image: busybox\nenabled: false\n"},
+		Dependencies: []*helm_chart.Chart{
+			{
+				Metadata: &helm_chart.Metadata{Name: "subchart", Version: "0.1.0"},
+				Templates: []*helm_chart.Template{
+					{Name: "templates/NOTES.txt", Data: []byte("Subchart notes\n")},
+				},
+				Values: &helm_chart.Config{Raw: ""},
+			},
+		},
+	}
+
+	request := &renderRequest{Name: "preview", Namespace: "ci", Values: map[string]interface{}{"image": "alpine"}}
+	manifests, notes, err := renderChart(chart, request)
+	suite.Nil(err, "no error rendering chart")
+	suite.Equal(map[string]string{"mychart/templates/pod.yaml": "name: preview-mychart\nimage: alpine\n"}, manifests,
+		"partials, notes and empty templates left out of manifests")
+	suite.Equal("Installed preview\n", notes, "notes of the chart rendered, without those of its dependencies")
+}
+
 func (suite *ServerTestSuite) TestRoutes() {
 	var body io.Reader
 	var res gin.ResponseWriter
@@ -150,6 +1108,7 @@ func (suite *ServerTestSuite) TestRoutes() {
 	// GET /charts/<filename>
 	res = suite.doRequest(false, false, "GET", "/charts/mychart-0.1.0.tgz", nil)
 	suite.Equal(200, res.Status(), "200 GET /charts/mychart-0.1.0.tgz")
+	suite.NotEmpty(res.Header().Get("Content-Length"), "Content-Length set GET /charts/mychart-0.1.0.tgz")
 
 	res = suite.doRequest(false, false, "GET", "/charts/mychart-0.1.0.tgz.prov", nil)
 	suite.Equal(200, res.Status(), "200 GET /charts/mychart-0.1.0.tgz.prov")
@@ -161,24 +1120,66 @@ func (suite *ServerTestSuite) TestRoutes() {
 	suite.Equal(404, res.Status(), "404 GET /charts/fakechart-0.1.0.tgz.prov")
 
 	res = suite.doRequest(false, false, "GET", "/charts/fakechart-0.1.0.bad", nil)
-	suite.Equal(500, res.Status(), "500 GET /charts/fakechart-0.1.0.bad")
+	suite.Equal(400, res.Status(), "400 GET /charts/fakechart-0.1.0.bad")
 
 	// GET /api/charts
 	res = suite.doRequest(false, false, "GET", "/api/charts", nil)
 	suite.Equal(200, res.Status(), "200 GET /api/charts")
 
+	res = suite.doRequest(false, false, "GET", "/api/charts?offset=0&limit=1&sort=created&order=desc&fields=name,version", nil)
+	suite.Equal(200, res.Status(), "200 GET /api/charts?offset=0&limit=1&sort=created&order=desc&fields=name,version")
+	suite.Equal("1", res.Header().Get("X-Total-Count"), "X-Total-Count set GET /api/charts")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts?sort=size", nil)
+	suite.Equal(400, res.Status(), "400 GET /api/charts?sort=size")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts?offset=x", nil)
+	suite.Equal(400, res.Status(), "400 GET /api/charts?offset=x")
+
 	res = suite.doRequest(true, false, "GET", "/api/charts", nil)
-	suite.Equal(500, res.Status(), "500 GET /api/charts")
+	suite.Equal(503, res.Status(), "503 GET /api/charts")
+
+	// GET /api/search
+	res = suite.doRequest(false, false, "GET", "/api/search?q=mychart", nil)
+	suite.Equal(200, res.Status(), "200 GET /api/search?q=mychart")
+
+	res = suite.doRequest(false, false, "GET", "/api/search?q=my&latest&offset=0&limit=10", nil)
+	suite.Equal(200, res.Status(), "200 GET /api/search?q=my&latest&offset=0&limit=10")
+
+	res = suite.doRequest(false, false, "GET", "/api/search?q=mychart&limit=-1", nil)
+	suite.Equal(400, res.Status(), "400 GET /api/search?q=mychart&limit=-1")
+
+	res = suite.doRequest(true, false, "GET", "/api/search?q=mychart", nil)
+	suite.Equal(503, res.Status(), "503 GET /api/search?q=mychart")
 
 	// GET /api/charts/<chart>
 	res = suite.doRequest(false, false, "GET", "/api/charts/mychart", nil)
 	suite.Equal(200, res.Status(), "200 GET /api/charts/mychart")
 
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart?limit=1&sort=version&fields=digest", nil)
+	suite.Equal(200, res.Status(), "200 GET /api/charts/mychart?limit=1&sort=version&fields=digest")
+	suite.Equal("1", res.Header().Get("X-Total-Count"), "X-Total-Count set GET /api/charts/mychart")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart?order=up", nil)
+	suite.Equal(400, res.Status(), "400 GET /api/charts/mychart?order=up")
+
 	res = suite.doRequest(false, false, "GET", "/api/charts/fakechart", nil)
 	suite.Equal(404, res.Status(), "404 GET /api/charts/fakechart")
 
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart?version=~0.1", nil)
+	suite.Equal(200, res.Status(), "200 GET /api/charts/mychart?version=~0.1")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart?version=%3E%3D0.1.0%20%3C1.0.0&prerelease", nil)
+	suite.Equal(200, res.Status(), "200 GET /api/charts/mychart?version=>=0.1.0 <1.0.0&prerelease")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart?version=^1.0", nil)
+	suite.Equal(404, res.Status(), "404 GET /api/charts/mychart?version=^1.0")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart?version=latest", nil)
+	suite.Equal(400, res.Status(), "400 GET /api/charts/mychart?version=latest")
+
 	res = suite.doRequest(true, false, "GET", "/api/charts/mychart", nil)
-	suite.Equal(500, res.Status(), "500 GET /api/charts/mychart")
+	suite.Equal(503, res.Status(), "503 GET /api/charts/mychart")
 
 	// GET /api/charts/<chart>/<version>
 	res = suite.doRequest(false, false, "GET", "/api/charts/mychart/0.1.0", nil)
@@ -194,7 +1195,72 @@ func (suite *ServerTestSuite) TestRoutes() {
 	suite.Equal(404, res.Status(), "404 GET /api/charts/fakechart/0.1.0")
 
 	res = suite.doRequest(true, false, "GET", "/api/charts/mychart/0.1.0", nil)
-	suite.Equal(500, res.Status(), "500 GET /api/charts/mychart/0.1.0")
+	suite.Equal(503, res.Status(), "503 GET /api/charts/mychart/0.1.0")
+
+	// GET /api/charts/<chart>/<version>/<file>
+	for _, file := range []string{"chart", "values", "readme", "templates"} {
+		for _, query := range []string{"", "?format=raw", "?format=json"} {
+			url := fmt.Sprintf("/api/charts/mychart/0.1.0/%s%s", file, query)
+			res = suite.doRequest(false, false, "GET", url, nil)
+			suite.Equal(200, res.Status(), fmt.Sprintf("200 GET %s", url))
+		}
+	}
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart/latest/values", nil)
+	suite.Equal(200, res.Status(), "200 GET /api/charts/mychart/latest/values")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart/0.1.0/requirements", nil)
+	suite.Equal(404, res.Status(), "404 GET /api/charts/mychart/0.1.0/requirements")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/mychart/0.1.0/values?format=xml", nil)
+	suite.Equal(400, res.Status(), "400 GET /api/charts/mychart/0.1.0/values?format=xml")
+
+	res = suite.doRequest(false, false, "GET", "/api/charts/fakechart/0.1.0/values", nil)
+	suite.Equal(404, res.Status(), "404 GET /api/charts/fakechart/0.1.0/values")
+
+	res = suite.doRequest(true, false, "GET", "/api/charts/mychart/0.1.0/values", nil)
+	suite.Equal(503, res.Status(), "503 GET /api/charts/mychart/0.1.0/values")
+
+	// POST /api/charts/<chart>/<version>/render
+	res = suite.doRequest(false, false, "POST", "/api/charts/mychart/0.1.0/render", nil)
+	suite.Equal(200, res.Status(), "200 POST /api/charts/mychart/0.1.0/render")
+
+	doRenderRequest := func(urlStr string, body io.Reader) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request, _ = http.NewRequest("POST", urlStr, body)
+		c.Request.SetBasicAuth("user", "pass")
+		suite.Server.Router.HandleContext(c)
+		return recorder
+	}
+
+	body = bytes.NewBufferString(`{"name": "preview", "namespace": "ci", "values": {"image": "alpine"}}`)
+	recorder := doRenderRequest("/api/charts/mychart/latest/render?format=json", body)
+	suite.Equal(200, recorder.Code, "200 POST /api/charts/mychart/latest/render?format=json")
+	var rendered struct {
+		Manifests map[string]string `json:"manifests"`
+		Notes     string            `json:"notes"`
+	}
+	suite.Nil(json.Unmarshal(recorder.Body.Bytes(), &rendered), "no error decoding rendered chart")
+	suite.Equal(1, len(rendered.Manifests), "one manifest rendered")
+	manifest := rendered.Manifests["mychart/templates/pod.yaml"]
+	suite.Contains(manifest, "image: 'alpine'", "values overridden in rendered manifest")
+	suite.Contains(manifest, "name: 'preview-mychart'", "release name used in rendered manifest")
+	suite.Equal("", rendered.Notes, "no notes rendered")
+
+	body = bytes.NewBufferString("name: preview\nvalues:\n  image: alpine\n")
+	recorder = doRenderRequest("/api/charts/mychart/0.1.0/render", body)
+	suite.Equal(200, recorder.Code, "200 POST /api/charts/mychart/0.1.0/render with yaml body")
+	suite.Contains(recorder.Body.String(), "# Source: mychart/templates/pod.yaml", "template path in rendered manifests")
+	suite.Contains(recorder.Body.String(), "image: 'alpine'", "values overridden in rendered manifests")
+	suite.Contains(recorder.Body.String(), "preview-mychart", "release name used in rendered manifests")
+
+	body = bytes.NewBufferString("[1, 2]")
+	res = suite.doRequest(false, false, "POST", "/api/charts/mychart/0.1.0/render", body)
+	suite.Equal(400, res.Status(), "400 POST /api/charts/mychart/0.1.0/render with invalid body")
+
+	res = suite.doRequest(false, false, "POST", "/api/charts/fakechart/0.1.0/render", nil)
+	suite.Equal(404, res.Status(), "404 POST /api/charts/fakechart/0.1.0/render")
 
 	// DELETE /api/charts/<chart>/<version>
 	res = suite.doRequest(false, false, "DELETE", "/api/charts/mychart/0.1.0", nil)
@@ -208,17 +1274,17 @@ func (suite *ServerTestSuite) TestRoutes() {
 	suite.Equal(200, res.Status(), "200 GET /index.yaml")
 
 	res = suite.doRequest(true, false, "GET", "/index.yaml", nil)
-	suite.Equal(500, res.Status(), "500 GET /index.yaml")
+	suite.Equal(503, res.Status(), "503 GET /index.yaml")
 
 	// POST /api/charts
 	body = bytes.NewBuffer([]byte{})
 	res = suite.doRequest(false, false, "POST", "/api/charts", body)
-	suite.Equal(500, res.Status(), "500 POST /api/charts")
+	suite.Equal(400, res.Status(), "400 POST /api/charts")
 
 	// POST /api/prov
 	body = bytes.NewBuffer([]byte{})
 	res = suite.doRequest(false, false, "POST", "/api/prov", body)
-	suite.Equal(500, res.Status(), "500 POST /api/prov")
+	suite.Equal(422, res.Status(), "422 POST /api/prov")
 
 	// POST /api/charts
 	content, err := ioutil.ReadFile(testTarballPath)
@@ -230,7 +1296,11 @@ func (suite *ServerTestSuite) TestRoutes() {
 
 	body = bytes.NewBuffer(content)
 	res = suite.doRequest(false, false, "POST", "/api/charts", body)
-	suite.Equal(500, res.Status(), "500 POST /api/charts")
+	suite.Equal(409, res.Status(), "409 POST /api/charts")
+
+	body = bytes.NewBuffer(content)
+	res = suite.doRequest(false, false, "POST", "/api/charts?force", body)
+	suite.Equal(409, res.Status(), "409 POST /api/charts?force, overwrite not allowed")
 
 	// POST /api/prov
 	content, err = ioutil.ReadFile(testProvfilePath)
@@ -242,7 +1312,7 @@ func (suite *ServerTestSuite) TestRoutes() {
 
 	body = bytes.NewBuffer(content)
 	res = suite.doRequest(false, false, "POST", "/api/prov", body)
-	suite.Equal(500, res.Status(), "500 POST /api/prov")
+	suite.Equal(409, res.Status(), "409 POST /api/prov")
 
 	// Test that all /api routes disabled if EnableAPI=false
 	res = suite.doRequest(false, true, "GET", "/api/charts", nil)
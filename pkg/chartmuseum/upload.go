@@ -0,0 +1,141 @@
+package chartmuseum
+
+import (
+	"errors"
+	"io/ioutil"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	multipartContentType = "multipart/form-data"
+
+	// chartFormField and provFormField are the names of the parts of a multipart upload
+	chartFormField = "chart"
+	provFormField  = "prov"
+
+	errorInvalidMultipartUpload = errors.New("multipart upload requires a chart part and a prov part")
+	errorProvenanceMismatch     = errors.New("provenance file does not match chart package")
+)
+
+// postMultipartUploadRequestHandler saves a chart package and its provenance file uploaded together,
+// both or neither, so the chart version is never published without its provenance file
+func (server *Server) postMultipartUploadRequestHandler(c *gin.Context) {
+	content, err := formFileContent(c, chartFormField)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	provContent, err := formFileContent(c, provFormField)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	filename, err := server.validateChartPackage(content)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	provFilename, err := server.validateProvenanceFile(filename, content, provContent)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	overwrite := server.overwriteRequested(c)
+	previous, err := server.StorageBackend.GetObject(filename)
+	exists := err == nil
+	if err != nil && err != storage.ErrorObjectNotFound {
+		errorResponse(c, err)
+		return
+	}
+	provExists, err := server.storageObjectExists(provFilename)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	if (exists || provExists) && !overwrite {
+		errorResponse(c, storage.ErrorObjectAlreadyExists)
+		return
+	}
+
+	server.Logger.Debugw("Adding package and provenance file to storage",
+		"package", filename,
+		"provenance_file", provFilename,
+		"overwrite", overwrite,
+	)
+	err = server.StorageBackend.PutObject(filename, content)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+	err = server.StorageBackend.PutObject(provFilename, provContent)
+	if err != nil {
+		server.rollbackChartPackage(filename, previous, exists)
+		errorResponse(c, err)
+		return
+	}
+	server.Metrics.addUploadBytes(len(content) + len(provContent))
+	err = server.addChartToIndex(filename, content)
+	if err != nil {
+		server.indexUpdateFailed(filename, err)
+	}
+	c.JSON(201, objectSavedResponse)
+}
+
+// formFileContent returns the content of a file part of a multipart upload
+func formFileContent(c *gin.Context, field string) ([]byte, error) {
+	file, _, err := c.Request.FormFile(field)
+	if err != nil {
+		// missing part or malformed body
+		return nil, errorInvalidMultipartUpload
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// validateProvenanceFile returns the filename of a provenance file uploaded with a chart package,
+// checking it is for that package and, if a keyring is configured, signed by a trusted key
+func (server *Server) validateProvenanceFile(filename string, content []byte, provContent []byte) (string, error) {
+	provFilename, err := repo.ProvenanceFilenameFromContent(provContent)
+	if err != nil {
+		return "", err
+	}
+	if provFilename != repo.ProvenanceFilenameFromChartPackageFilename(filename) {
+		return "", errorProvenanceMismatch
+	}
+	matches, err := repo.ProvenanceFileMatchesChartPackage(provContent, content)
+	if err != nil {
+		return "", err
+	}
+	if !matches {
+		return "", errorProvenanceMismatch
+	}
+	if server.ProvenanceVerifier != nil {
+		err = repo.VerifyProvenanceFile(server.ProvenanceVerifier, provContent, filename, content)
+		if err != nil {
+			return "", err
+		}
+	}
+	return provFilename, nil
+}
+
+// rollbackChartPackage restores the chart package replaced by an upload that could not be completed,
+// or deletes it if there was none
+func (server *Server) rollbackChartPackage(filename string, previous storage.Object, existed bool) {
+	var err error
+	if existed {
+		err = server.StorageBackend.PutObject(filename, previous.Content)
+	} else {
+		err = server.StorageBackend.DeleteObject(filename)
+	}
+	if err != nil {
+		server.Logger.Errorw("Unable to roll back chart package after failed upload",
+			"package", filename,
+			"error", err.Error(),
+		)
+	}
+}
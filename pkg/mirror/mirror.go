@@ -0,0 +1,272 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/Masterminds/semver"
+	"k8s.io/helm/pkg/provenance"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var (
+	// DefaultParallelism is the number of chart versions mirrored at the same time, if not set
+	DefaultParallelism = 4
+
+	// ErrorDigestMismatch is raised when a downloaded chart package does not match the digest in the remote index
+	ErrorDigestMismatch = errors.New("chart package digest does not match remote index")
+)
+
+const (
+	// StatusAdded is the status of a chart version missing from storage
+	StatusAdded = "added"
+
+	// StatusChanged is the status of a chart version whose package in storage differs from the remote one
+	StatusChanged = "changed"
+
+	// StatusUnchanged is the status of a chart version already in storage
+	StatusUnchanged = "unchanged"
+
+	// StatusFailed is the status of a chart version that could not be mirrored
+	StatusFailed = "failed"
+)
+
+type (
+	// Mirror copies the chart packages (and provenance files) of a remote repository to a storage backend
+	Mirror struct {
+		Remote            *repo.RemoteRepository
+		Backend           storage.Backend
+		NameRegexp        *regexp.Regexp
+		VersionConstraint *semver.Constraints
+		Parallelism       int
+		DryRun            bool
+	}
+
+	// Options are options for constructing a Mirror
+	Options struct {
+		RepositoryURL string
+		ChartName     string
+		ChartVersion  string
+		Parallelism   int
+		DryRun        bool
+	}
+
+	// Result is the outcome of mirroring a single chart version
+	Result struct {
+		Name     string
+		Version  string
+		Filename string
+		Status   string
+		Err      error
+	}
+
+	// Report contains the result of every chart version selected for mirroring
+	Report struct {
+		Results []Result
+		DryRun  bool
+	}
+)
+
+// NewMirror creates a new Mirror instance
+func NewMirror(backend storage.Backend, options Options) (*Mirror, error) {
+	mirror := &Mirror{
+		Remote:      repo.NewRemoteRepository(options.RepositoryURL),
+		Backend:     backend,
+		Parallelism: options.Parallelism,
+		DryRun:      options.DryRun,
+	}
+	if mirror.Parallelism <= 0 {
+		mirror.Parallelism = DefaultParallelism
+	}
+	if options.ChartName != "" {
+		nameRegexp, err := regexp.Compile(options.ChartName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart name regexp: %s", err)
+		}
+		mirror.NameRegexp = nameRegexp
+	}
+	if options.ChartVersion != "" {
+		versionConstraint, err := semver.NewConstraint(options.ChartVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart version constraint: %s", err)
+		}
+		mirror.VersionConstraint = versionConstraint
+	}
+	return mirror, nil
+}
+
+// Run mirrors every chart version of the remote index selected by the name and version filters;
+// only a failure to fetch the remote index is returned as an error, others are part of the report
+func (mirror *Mirror) Run() (*Report, error) {
+	indexFile, err := mirror.Remote.FetchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	chartVersions := mirror.selectChartVersions(indexFile)
+	results := make([]Result, len(chartVersions))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(mirror.Parallelism)
+	for i := 0; i < mirror.Parallelism; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = mirror.mirrorChartVersion(chartVersions[j])
+			}
+		}()
+	}
+	for j := range chartVersions {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	return &Report{Results: results, DryRun: mirror.DryRun}, nil
+}
+
+// selectChartVersions returns the chart versions matching the filters, ordered by name then newest version first
+func (mirror *Mirror) selectChartVersions(indexFile *helm_repo.IndexFile) []*helm_repo.ChartVersion {
+	names := []string{}
+	for name := range indexFile.Entries {
+		if mirror.NameRegexp == nil || mirror.NameRegexp.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	selected := []*helm_repo.ChartVersion{}
+	for _, name := range names {
+		for _, chartVersion := range indexFile.Entries[name] {
+			if mirror.VersionConstraint != nil {
+				version, err := semver.NewVersion(chartVersion.Version)
+				if err != nil || !mirror.VersionConstraint.Check(version) {
+					continue
+				}
+			}
+			selected = append(selected, chartVersion)
+		}
+	}
+	return selected
+}
+
+func (mirror *Mirror) mirrorChartVersion(chartVersion *helm_repo.ChartVersion) Result {
+	result := Result{Name: chartVersion.Name, Version: chartVersion.Version}
+	if len(chartVersion.URLs) == 0 {
+		result.Status = StatusFailed
+		result.Err = errors.New("no url in remote index")
+		return result
+	}
+	result.Filename = repo.RemoteChartPackageFilename(chartVersion.URLs[0])
+
+	status, err := mirror.packageStatus(result.Filename, chartVersion.Digest)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Err = err
+		return result
+	}
+	result.Status = status
+	if status == StatusUnchanged || mirror.DryRun {
+		return result
+	}
+
+	packageURL, err := mirror.Remote.ResolveURL(chartVersion.URLs[0])
+	if err == nil {
+		err = mirror.download(result.Filename, packageURL, chartVersion.Digest)
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Err = err
+	}
+	return result
+}
+
+// packageStatus compares the chart package in storage, if any, to the digest found in the remote index
+func (mirror *Mirror) packageStatus(filename string, digest string) (string, error) {
+	object, err := mirror.Backend.GetObject(filename)
+	if err == storage.ErrorObjectNotFound {
+		return StatusAdded, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		// nothing to compare against, the package is assumed to be up to date
+		return StatusUnchanged, nil
+	}
+	localDigest, err := provenance.Digest(bytes.NewBuffer(object.Content))
+	if err != nil {
+		return "", err
+	}
+	if localDigest != digest {
+		return StatusChanged, nil
+	}
+	return StatusUnchanged, nil
+}
+
+// download saves a chart package to storage, along with its provenance file if the remote repository has one
+func (mirror *Mirror) download(filename string, packageURL string, digest string) error {
+	content, err := mirror.Remote.Fetch(packageURL)
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		downloadedDigest, err := provenance.Digest(bytes.NewBuffer(content))
+		if err != nil {
+			return err
+		}
+		if downloadedDigest != digest {
+			return ErrorDigestMismatch
+		}
+	}
+
+	// provenance files sit next to their chart package, as expected by helm
+	provContent, err := mirror.Remote.Fetch(packageURL + ".prov")
+	if err != nil && err != repo.ErrorRemoteFileNotFound {
+		return err
+	}
+
+	err = mirror.Backend.PutObject(filename, content)
+	if err != nil {
+		return err
+	}
+	provFilename := repo.ProvenanceFilenameFromChartPackageFilename(filename)
+	if provContent != nil {
+		return mirror.Backend.PutObject(provFilename, provContent)
+	}
+	// a provenance file left from a previous version of the package no longer matches
+	err = mirror.Backend.DeleteObject(provFilename)
+	if err != nil && err != storage.ErrorObjectNotFound {
+		return err
+	}
+	return nil
+}
+
+// Count returns the number of results with a given status
+func (report *Report) Count(status string) int {
+	count := 0
+	for _, result := range report.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Summary returns a one-line summary of the report
+func (report *Report) Summary() string {
+	summary := fmt.Sprintf("%d added, %d changed, %d unchanged, %d failed",
+		report.Count(StatusAdded), report.Count(StatusChanged), report.Count(StatusUnchanged), report.Count(StatusFailed))
+	if report.DryRun {
+		summary = fmt.Sprintf("%s (dry run, nothing downloaded)", summary)
+	}
+	return summary
+}
@@ -0,0 +1,148 @@
+package mirror
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chartmuseum/chartmuseum/pkg/repo"
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/stretchr/testify/suite"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var testTarballPath = "../../testdata/charts/mychart/mychart-0.1.0.tgz"
+var testProvfilePath = "../../testdata/charts/mychart/mychart-0.1.0.tgz.prov"
+
+type MirrorTestSuite struct {
+	suite.Suite
+	Upstream        *httptest.Server
+	TempDirectory   string
+	TarballContent  []byte
+	ProvfileContent []byte
+}
+
+func (suite *MirrorTestSuite) SetupSuite() {
+	var err error
+	suite.TarballContent, err = ioutil.ReadFile(testTarballPath)
+	suite.Nil(err, "no error reading test tarball")
+	suite.ProvfileContent, err = ioutil.ReadFile(testProvfilePath)
+	suite.Nil(err, "no error reading test provenance file")
+
+	index := repo.NewIndex("")
+	chartVersion, err := repo.ChartVersionFromStorageObject(storage.Object{
+		Path:         "mychart-0.1.0.tgz",
+		Content:      suite.TarballContent,
+		LastModified: time.Now(),
+	})
+	suite.Nil(err, "no error creating chart version from test tarball")
+	index.AddEntry(chartVersion)
+	index.AddEntry(&helm_repo.ChartVersion{
+		Metadata: &helm_chart.Metadata{Name: "missingchart", Version: "1.0.0"},
+		URLs:     []string{"charts/missingchart-1.0.0.tgz"},
+	})
+	err = index.Regenerate()
+	suite.Nil(err, "no error regenerating upstream index")
+
+	suite.Upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			w.Write(index.Raw)
+		case "/charts/mychart-0.1.0.tgz":
+			w.Write(suite.TarballContent)
+		case "/charts/mychart-0.1.0.tgz.prov":
+			w.Write(suite.ProvfileContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	timestamp := time.Now().Format("20060102150405")
+	suite.TempDirectory = fmt.Sprintf("../../.test/chartmuseum-mirror/%s", timestamp)
+}
+
+func (suite *MirrorTestSuite) TearDownSuite() {
+	suite.Upstream.Close()
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *MirrorTestSuite) TestNewMirror() {
+	backend := storage.NewLocalFilesystemBackend(suite.TempDirectory)
+
+	mirror, err := NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL})
+	suite.Nil(err, "no error creating mirror without filters")
+	suite.Equal(DefaultParallelism, mirror.Parallelism, "default parallelism")
+
+	_, err = NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL, ChartName: "("})
+	suite.NotNil(err, "error creating mirror with invalid chart name regexp")
+
+	_, err = NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL, ChartVersion: "not a constraint"})
+	suite.NotNil(err, "error creating mirror with invalid chart version constraint")
+}
+
+func (suite *MirrorTestSuite) TestRun() {
+	tempDirectory := fmt.Sprintf("%s/run", suite.TempDirectory)
+	backend := storage.NewLocalFilesystemBackend(tempDirectory)
+
+	mirror, err := NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL, DryRun: true})
+	suite.Nil(err, "no error creating dry run mirror")
+	report, err := mirror.Run()
+	suite.Nil(err, "no error running dry run mirror")
+	suite.Equal(2, report.Count(StatusAdded), "dry run reports chart versions to add")
+	_, err = backend.GetObject("mychart-0.1.0.tgz")
+	suite.Equal(storage.ErrorObjectNotFound, err, "nothing downloaded in dry run")
+
+	mirror, err = NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL, Parallelism: 2})
+	suite.Nil(err, "no error creating mirror")
+	report, err = mirror.Run()
+	suite.Nil(err, "no error running mirror")
+	suite.Equal(1, report.Count(StatusAdded), "chart version added")
+	suite.Equal(1, report.Count(StatusFailed), "chart version missing upstream failed")
+	suite.Equal("missingchart", report.Results[0].Name, "results ordered by chart name")
+	suite.Equal(repo.ErrorRemoteFileNotFound, report.Results[0].Err, "not found error for chart version missing upstream")
+
+	object, err := backend.GetObject("mychart-0.1.0.tgz")
+	suite.Nil(err, "chart package saved to storage")
+	suite.Equal(suite.TarballContent, object.Content, "chart package content saved to storage")
+	object, err = backend.GetObject("mychart-0.1.0.tgz.prov")
+	suite.Nil(err, "provenance file saved to storage")
+	suite.Equal(suite.ProvfileContent, object.Content, "provenance file content saved to storage")
+
+	mirror, err = NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL, ChartName: "^mychart$"})
+	suite.Nil(err, "no error creating mirror with chart name regexp")
+	report, err = mirror.Run()
+	suite.Nil(err, "no error running mirror again")
+	suite.Equal(1, len(report.Results), "only chart versions matching chart name regexp selected")
+	suite.Equal(StatusUnchanged, report.Results[0].Status, "chart version already in storage unchanged")
+
+	err = backend.PutObject("mychart-0.1.0.tgz", []byte("modified"))
+	suite.Nil(err, "no error modifying chart package in storage")
+	report, err = mirror.Run()
+	suite.Nil(err, "no error running mirror after modifying chart package")
+	suite.Equal(StatusChanged, report.Results[0].Status, "modified chart version changed")
+	object, err = backend.GetObject("mychart-0.1.0.tgz")
+	suite.Nil(err, "chart package still in storage")
+	suite.Equal(suite.TarballContent, object.Content, "modified chart package downloaded again")
+
+	mirror, err = NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL, ChartVersion: ">=1.0.0"})
+	suite.Nil(err, "no error creating mirror with chart version constraint")
+	report, err = mirror.Run()
+	suite.Nil(err, "no error running mirror with chart version constraint")
+	suite.Equal(1, len(report.Results), "only chart versions matching chart version constraint selected")
+	suite.Equal("missingchart", report.Results[0].Name, "chart version matching constraint selected")
+
+	mirror, err = NewMirror(backend, Options{RepositoryURL: suite.Upstream.URL + "/missing"})
+	suite.Nil(err, "no error creating mirror of missing repository")
+	_, err = mirror.Run()
+	suite.Equal(repo.ErrorRemoteFileNotFound, err, "error running mirror of missing repository")
+}
+
+func TestMirrorTestSuite(t *testing.T) {
+	suite.Run(t, new(MirrorTestSuite))
+}
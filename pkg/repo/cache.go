@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/ghodss/yaml"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var (
+	// IndexCacheFilename is the name of the storage object used to persist the index cache
+	IndexCacheFilename = "index-cache.yaml"
+)
+
+type (
+	// IndexCache is a snapshot of the repository index along with the storage objects it was generated from
+	IndexCache struct {
+		ChartURL  string               `json:"chartURL"`
+		IndexFile *helm_repo.IndexFile `json:"index"`
+		Objects   []IndexCacheObject   `json:"objects"`
+	}
+
+	// IndexCacheObject is the fingerprint of a storage object used to detect changes since the cache was written
+	IndexCacheObject struct {
+		Path         string    `json:"path"`
+		LastModified time.Time `json:"lastModified"`
+	}
+)
+
+// NewIndexCache creates a new instance of IndexCache
+func NewIndexCache(index *Index, objects []storage.Object) *IndexCache {
+	cache := IndexCache{
+		ChartURL:  index.ChartURL,
+		IndexFile: index.IndexFile,
+		Objects:   []IndexCacheObject{},
+	}
+	for _, object := range objects {
+		cache.Objects = append(cache.Objects, IndexCacheObject{
+			Path:         object.Path,
+			LastModified: object.LastModified,
+		})
+	}
+	return &cache
+}
+
+// IndexCacheFromContent returns an index cache from binary content
+func IndexCacheFromContent(content []byte) (*IndexCache, error) {
+	cache := new(IndexCache)
+	err := yaml.Unmarshal(content, cache)
+	if err != nil {
+		return cache, err
+	}
+	if cache.IndexFile == nil {
+		cache.IndexFile = &helm_repo.IndexFile{}
+	}
+	if cache.IndexFile.Entries == nil {
+		cache.IndexFile.Entries = map[string]helm_repo.ChartVersions{}
+	}
+	return cache, nil
+}
+
+// Content returns the index cache serialized as yaml
+func (cache *IndexCache) Content() ([]byte, error) {
+	return yaml.Marshal(cache)
+}
+
+// Index returns the cached repository index
+func (cache *IndexCache) Index() (*Index, error) {
+	index := NewIndex(cache.ChartURL)
+	index.IndexFile = cache.IndexFile
+	index.APIVersion = helm_repo.APIVersionV1
+	err := index.Regenerate()
+	return index, err
+}
+
+// StorageObjects returns the storage objects the cached index was generated from
+func (cache *IndexCache) StorageObjects() []storage.Object {
+	objects := []storage.Object{}
+	for _, o := range cache.Objects {
+		objects = append(objects, storage.Object{
+			Path:         o.Path,
+			Content:      []byte{},
+			LastModified: o.LastModified,
+		})
+	}
+	return objects
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chartmuseum/chartmuseum/pkg/storage"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type IndexCacheTestSuite struct {
+	suite.Suite
+}
+
+func (suite *IndexCacheTestSuite) TestIndexCache() {
+	now := time.Now()
+	index := NewIndex("http://mysite.com:8080")
+	index.AddEntry(getChartVersion("a", 0, now))
+	index.AddEntry(getChartVersion("a", 1, now))
+	index.AddEntry(getChartVersion("b", 0, now))
+	err := index.Regenerate()
+	suite.Nil(err, "no error regenerating index")
+
+	objects := []storage.Object{
+		{Path: "a-1.0.0.tgz", Content: []byte{}, LastModified: now},
+		{Path: "a-1.0.1.tgz", Content: []byte{}, LastModified: now},
+		{Path: "b-1.0.0.tgz", Content: []byte{}, LastModified: now},
+	}
+
+	content, err := NewIndexCache(index, objects).Content()
+	suite.Nil(err, "no error serializing index cache")
+
+	cache, err := IndexCacheFromContent(content)
+	suite.Nil(err, "no error loading index cache from content")
+	suite.Equal("http://mysite.com:8080", cache.ChartURL, "chart url as expected")
+
+	cachedIndex, err := cache.Index()
+	suite.Nil(err, "no error getting index from index cache")
+	suite.Equal(2, len(cachedIndex.Entries["a"]), "two versions of chart a in cached index")
+	suite.Equal(1, len(cachedIndex.Entries["b"]), "one version of chart b in cached index")
+	suite.Equal("http://mysite.com:8080/charts/b-1.0.0.tgz", cachedIndex.Entries["b"][0].URLs[0], "chart url preserved")
+	suite.NotEmpty(cachedIndex.Raw, "cached index raw content regenerated")
+
+	cachedObjects := cache.StorageObjects()
+	suite.Equal(len(objects), len(cachedObjects), "storage objects loaded from index cache")
+	diff := storage.GetObjectSliceDiff(objects, cachedObjects)
+	suite.False(diff.Change, "no change detected between original and cached storage objects")
+
+	_, err = IndexCacheFromContent([]byte("this should create an error"))
+	suite.NotNil(err, "error loading index cache from bad content")
+
+	cache, err = IndexCacheFromContent([]byte{})
+	suite.Nil(err, "no error loading index cache from empty content")
+	suite.Empty(cache.StorageObjects(), "no storage objects in empty index cache")
+}
+
+func TestIndexCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(IndexCacheTestSuite))
+}
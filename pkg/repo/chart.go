@@ -35,7 +35,7 @@ func ChartPackageFilenameFromNameVersion(name string, version string) string {
 func ChartPackageFilenameFromContent(content []byte) (string, error) {
 	chart, err := chartFromContent(content)
 	if err != nil {
-		return "", err
+		return "", ErrorInvalidChartPackage
 	}
 	meta := chart.Metadata
 	filename := fmt.Sprintf("%s-%s.%s", meta.Name, meta.Version, ChartPackageFileExtension)
@@ -68,6 +68,34 @@ func ChartVersionFromStorageObject(object storage.Object) (*helm_repo.ChartVersi
 	return chartVersion, nil
 }
 
+// ChartVersionFromFile returns a chart version from a chart package on disk, not yet in storage
+func ChartVersionFromFile(path string) (*helm_repo.ChartVersion, error) {
+	chart, err := chartutil.LoadFile(path)
+	if err != nil {
+		return new(helm_repo.ChartVersion), ErrorInvalidChartPackage
+	}
+	digest, err := provenanceDigestFromFile(path)
+	if err != nil {
+		return new(helm_repo.ChartVersion), err
+	}
+	filename := ChartPackageFilenameFromNameVersion(chart.Metadata.Name, chart.Metadata.Version)
+	chartVersion := &helm_repo.ChartVersion{
+		URLs:     []string{fmt.Sprintf("charts/%s", filename)},
+		Metadata: chart.Metadata,
+		Digest:   digest,
+	}
+	return chartVersion, nil
+}
+
+// ChartFromContent returns the chart contained in a chart package
+func ChartFromContent(content []byte) (*helm_chart.Chart, error) {
+	chart, err := chartFromContent(content)
+	if err != nil {
+		return nil, ErrorInvalidChartPackage
+	}
+	return chart, nil
+}
+
 func chartFromContent(content []byte) (*helm_chart.Chart, error) {
 	chart, err := chartutil.LoadArchive(bytes.NewBuffer(content))
 	return chart, err
@@ -57,9 +57,23 @@ func (suite *ChartTestSuite) TestChartVersionFromStorageObject() {
 	suite.Equal(err, ErrorInvalidChartPackage, "error creating ChartVersion from storage.Object with bad content")
 }
 
+func (suite *ChartTestSuite) TestChartVersionFromFile() {
+	chartVersion, err := ChartVersionFromFile("../../testdata/charts/mychart/mychart-0.1.0.tgz")
+	suite.Nil(err, "no error creating ChartVersion from test tarball")
+	suite.Equal("mychart", chartVersion.Name, "chart name as expected")
+	suite.Equal("0.1.0", chartVersion.Version, "chart version as expected")
+	suite.Equal([]string{"charts/mychart-0.1.0.tgz"}, chartVersion.URLs, "chart URLs as expected")
+	digest, err := provenanceDigestFromContent(suite.TarballContent)
+	suite.Nil(err, "no error computing digest of test tarball content")
+	suite.Equal(digest, chartVersion.Digest, "chart digest as expected")
+
+	_, err = ChartVersionFromFile("../../testdata/charts/mychart/Chart.yaml")
+	suite.Equal(ErrorInvalidChartPackage, err, "ErrorInvalidChartPackage creating ChartVersion from a file that is not a chart package")
+}
+
 func (suite *ChartTestSuite) TestChartPackageFilenameFromContent() {
 	filename, err := ChartPackageFilenameFromContent([]byte{})
-	suite.NotNil(err, "error getting tarball filename with empty byte array")
+	suite.Equal(ErrorInvalidChartPackage, err, "ErrorInvalidChartPackage getting tarball filename with empty byte array")
 	suite.Equal("", filename, "filename blank with empty byte array")
 
 	filename, err = ChartPackageFilenameFromContent(suite.TarballContent)
@@ -67,6 +81,16 @@ func (suite *ChartTestSuite) TestChartPackageFilenameFromContent() {
 	suite.Equal("mychart-0.1.0.tgz", filename, "chart tarball filename as expected")
 }
 
+func (suite *ChartTestSuite) TestChartFromContent() {
+	_, err := ChartFromContent([]byte("not a chart package"))
+	suite.Equal(ErrorInvalidChartPackage, err, "ErrorInvalidChartPackage loading chart from bad content")
+
+	chart, err := ChartFromContent(suite.TarballContent)
+	suite.Nil(err, "no error loading chart from test tarball content")
+	suite.Equal("mychart", chart.Metadata.Name, "chart name as expected")
+	suite.NotEmpty(chart.Templates, "chart templates loaded")
+}
+
 func TestChartTestSuite(t *testing.T) {
 	suite.Run(t, new(ChartTestSuite))
 }
@@ -1,9 +1,13 @@
 package repo
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver"
 	"github.com/ghodss/yaml"
 
 	helm_repo "k8s.io/helm/pkg/repo"
@@ -12,6 +16,18 @@ import (
 var (
 	// IndexFileContentType is the http content-type header for index.yaml
 	IndexFileContentType = "application/x-yaml"
+
+	// ErrorChartNotFound is raised when a chart or chart version is not in the index
+	ErrorChartNotFound = errors.New("chart not found")
+
+	// ErrorInvalidVersionConstraint is raised when a chart version constraint is not a valid semver constraint
+	ErrorInvalidVersionConstraint = errors.New("invalid version constraint")
+
+	// constraintSeparatorRegexp matches the space between two comparisons of a constraint (e.g. ">=1.0 <2.0")
+	constraintSeparatorRegexp = regexp.MustCompile(`([0-9xX*])\s+([<>=!~^])`)
+
+	// versionComparisonRegexp matches a comparison with a complete version (e.g. "<2.0.0", ">=1.0.0-beta.1")
+	versionComparisonRegexp = regexp.MustCompile(`^(<=|>=|=<|=>|!=|<|>|=)?\s*v?([0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?)$`)
 )
 
 // Index represents the repository index (index.yaml)
@@ -42,6 +58,16 @@ func (index *Index) Regenerate() error {
 	return nil
 }
 
+// Copy returns a copy of the index whose entries can be modified without affecting the original
+func (index *Index) Copy() *Index {
+	indexFile := *index.IndexFile
+	indexFile.Entries = map[string]helm_repo.ChartVersions{}
+	for name, chartVersions := range index.Entries {
+		indexFile.Entries[name] = append(helm_repo.ChartVersions{}, chartVersions...)
+	}
+	return &Index{&indexFile, index.Raw, index.ChartURL}
+}
+
 // RemoveEntry removes a chart version from index
 func (index *Index) RemoveEntry(chartVersion *helm_repo.ChartVersion) {
 	for k := range index.Entries {
@@ -86,6 +112,103 @@ func (index *Index) UpdateEntry(chartVersion *helm_repo.ChartVersion) {
 	}
 }
 
+// GetMatching returns the newest version of a chart matching a semver constraint (e.g. "~1.2", ">=1.0 <2.0");
+// prereleases are only considered if the constraint includes one, or if prerelease is true
+func (index *Index) GetMatching(name string, constraint string, prerelease bool) (*helm_repo.ChartVersion, error) {
+	constraint = constraintSeparatorRegexp.ReplaceAllString(strings.TrimSpace(constraint), "$1, $2")
+	constraints, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, ErrorInvalidVersionConstraint
+	}
+	// entries are sorted newest version first
+	for _, chartVersion := range index.Entries[name] {
+		version, err := semver.NewVersion(chartVersion.Version)
+		if err != nil {
+			continue
+		}
+		if versionMatches(constraints, constraint, version, prerelease) {
+			return chartVersion, nil
+		}
+	}
+	return nil, ErrorChartNotFound
+}
+
+func versionMatches(constraints *semver.Constraints, constraint string, version *semver.Version, prerelease bool) bool {
+	if constraints.Check(version) {
+		return true
+	}
+	if !prerelease || version.Prerelease() == "" {
+		return false
+	}
+	// constraints never match prereleases unless they include one themselves, so each comparison is checked
+	// as if its bounds included prereleases
+	for _, group := range strings.Split(constraint, "||") {
+		matches := true
+		for _, comparison := range strings.Split(group, ",") {
+			if !prereleaseMatchesComparison(strings.TrimSpace(comparison), version) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// prereleaseMatchesComparison checks a prerelease against a single comparison: a comparison with a version is
+// applied as is (e.g. 2.0.0-rc.1 matches "<2.0.0"), while a range (e.g. "~1.2", "^1.0") is checked against
+// the release, which includes the prereleases of its lower bound but not of its upper bound, as with "-0" bounds
+func prereleaseMatchesComparison(comparison string, version *semver.Version) bool {
+	if m := versionComparisonRegexp.FindStringSubmatch(comparison); m != nil {
+		bound, err := semver.NewVersion(m[2])
+		if err != nil {
+			return false
+		}
+		result := version.Compare(bound)
+		switch m[1] {
+		case "<":
+			return result < 0
+		case "<=", "=<":
+			return result <= 0
+		case ">":
+			return result > 0
+		case ">=", "=>":
+			return result >= 0
+		case "!=":
+			return result != 0
+		default:
+			return result == 0
+		}
+	}
+	release, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", version.Major(), version.Minor(), version.Patch()))
+	if err != nil {
+		return false
+	}
+	constraints, err := semver.NewConstraint(comparison)
+	return err == nil && constraints.Check(release)
+}
+
+// AddRemoteEntries adds chart versions of a remote index that are not already in index, pointing their
+// urls to this repository; the chart package filename of each chart version added is returned with its remote url
+func (index *Index) AddRemoteEntries(indexFile *helm_repo.IndexFile) map[string]string {
+	remoteURLs := map[string]string{}
+	for _, chartVersions := range indexFile.Entries {
+		for _, chartVersion := range chartVersions {
+			if len(chartVersion.URLs) == 0 || index.Has(chartVersion.Name, chartVersion.Version) {
+				continue
+			}
+			filename := RemoteChartPackageFilename(chartVersion.URLs[0])
+			remoteChartVersion := *chartVersion
+			remoteChartVersion.URLs = []string{fmt.Sprintf("charts/%s", filename)}
+			index.AddEntry(&remoteChartVersion)
+			remoteURLs[filename] = chartVersion.URLs[0]
+		}
+	}
+	return remoteURLs
+}
+
 func (index *Index) setChartURL(chartVersion *helm_repo.ChartVersion) {
 	if index.ChartURL != "" {
 		chartVersion.URLs[0] = strings.Join([]string{index.ChartURL, chartVersion.URLs[0]}, "/")
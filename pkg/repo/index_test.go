@@ -85,6 +85,94 @@ func (suite *IndexTestSuite) TestChartURLs() {
 		index.Entries["a"][0].URLs[0], "absolute chart url")
 }
 
+func (suite *IndexTestSuite) TestCopy() {
+	index := NewIndex("")
+	index.AddEntry(getChartVersion("a", 0, time.Now()))
+	index.AddEntry(getChartVersion("a", 1, time.Now()))
+
+	indexCopy := index.Copy()
+	indexCopy.RemoveEntry(getChartVersion("a", 0, time.Now()))
+	indexCopy.AddEntry(getChartVersion("b", 0, time.Now()))
+	suite.Equal(2, len(index.Entries["a"]), "original index entries untouched by remove")
+	suite.Equal("1.0.0", index.Entries["a"][0].Version, "original index entries untouched by remove")
+	suite.Nil(index.Entries["b"], "original index entries untouched by add")
+	suite.Equal(1, len(indexCopy.Entries["a"]), "copied index entries removed")
+	suite.Equal(1, len(indexCopy.Entries["b"]), "copied index entries added")
+}
+
+func (suite *IndexTestSuite) TestAddRemoteEntries() {
+	index := NewIndex("http://mysite.com:8080")
+	index.AddEntry(getChartVersion("a", 0, time.Now()))
+
+	remoteIndex := NewIndex("")
+	remoteChartVersion := getChartVersion("a", 0, time.Now())
+	remoteChartVersion.URLs = []string{"https://remote.com/charts/a-1.0.0.tgz"}
+	remoteIndex.AddEntry(remoteChartVersion)
+	remoteChartVersion = getChartVersion("a", 1, time.Now())
+	remoteChartVersion.URLs = []string{"https://remote.com/charts/a-1.0.1.tgz"}
+	remoteIndex.AddEntry(remoteChartVersion)
+	remoteIndex.AddEntry(getChartVersion("b", 0, time.Now()))
+
+	remoteURLs := index.AddRemoteEntries(remoteIndex.IndexFile)
+	suite.Equal(2, len(index.Entries["a"]), "remote chart version added, existing chart version kept")
+	suite.Equal(1, len(index.Entries["b"]), "remote chart added")
+	suite.Equal("http://mysite.com:8080/charts/a-1.0.1.tgz", index.Entries["a"][1].URLs[0], "remote chart url points to this repository")
+	suite.Equal("https://remote.com/charts/a-1.0.1.tgz", remoteIndex.Entries["a"][1].URLs[0], "remote index untouched")
+	suite.Equal(map[string]string{
+		"a-1.0.1.tgz": "https://remote.com/charts/a-1.0.1.tgz",
+		"b-1.0.0.tgz": "charts/b-1.0.0.tgz",
+	}, remoteURLs, "remote urls of added chart versions")
+}
+
+func (suite *IndexTestSuite) TestGetMatching() {
+	index := NewIndex("")
+	for _, version := range []string{"1.2.0", "1.2.5", "1.3.0-beta.1", "1.3.0", "2.0.0-rc.1", "2.0.0", "2.1.0-rc.1", "not-semver"} {
+		index.AddEntry(&helm_repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "a", Version: version},
+			URLs:     []string{fmt.Sprintf("charts/a-%s.tgz", version)},
+		})
+	}
+	index.SortEntries()
+
+	tests := []struct {
+		constraint string
+		prerelease bool
+		expected   string
+	}{
+		{"~1.2", false, "1.2.5"},
+		{"^1.0.0", false, "1.3.0"},
+		{">=1.0 <2.0", false, "1.3.0"},
+		{">=1.0, <1.3", false, "1.2.5"},
+		{"*", false, "2.0.0"},
+		{"*", true, "2.1.0-rc.1"},
+		{"~2.1", true, "2.1.0-rc.1"},
+		{"2.1.0-rc.1", false, "2.1.0-rc.1"},
+		{"<2.0.0", false, "1.3.0"},
+		{"<2.0.0", true, "2.0.0-rc.1"},
+		{">=1.0, <2.0.0", true, "2.0.0-rc.1"},
+		{"^1.0.0", true, "1.3.0"},
+		{">2.0.0", true, "2.1.0-rc.1"},
+		{"<1.3.0 || >=2.1.0", true, "1.3.0-beta.1"},
+	}
+	for _, test := range tests {
+		chartVersion, err := index.GetMatching("a", test.constraint, test.prerelease)
+		suite.Nil(err, fmt.Sprintf("no error getting chart version matching %q", test.constraint))
+		suite.Equal(test.expected, chartVersion.Version, fmt.Sprintf("chart version matching %q, prerelease=%t", test.constraint, test.prerelease))
+	}
+
+	_, err := index.GetMatching("a", "~2.1", false)
+	suite.Equal(ErrorChartNotFound, err, "prerelease not matched unless requested")
+
+	_, err = index.GetMatching("a", "~3", false)
+	suite.Equal(ErrorChartNotFound, err, "no chart version matching constraint")
+
+	_, err = index.GetMatching("b", "*", false)
+	suite.Equal(ErrorChartNotFound, err, "no chart matching name")
+
+	_, err = index.GetMatching("a", "not a constraint", false)
+	suite.Equal(ErrorInvalidVersionConstraint, err, "invalid constraint")
+}
+
 func TestIndexTestSuite(t *testing.T) {
 	suite.Run(t, new(IndexTestSuite))
 }
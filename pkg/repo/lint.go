@@ -0,0 +1,163 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathutil "path"
+	"strings"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/lint"
+	"k8s.io/helm/pkg/lint/support"
+)
+
+var (
+	// LintSeverities maps the names of lint severity thresholds to helm lint severities
+	LintSeverities = map[string]int{
+		"info":    support.InfoSev,
+		"warning": support.WarningSev,
+		"error":   support.ErrorSev,
+	}
+
+	// DefaultLintSeverity is the lint severity threshold used if none is given
+	DefaultLintSeverity = "error"
+
+	// ErrorInvalidLintSeverity is raised when a lint severity threshold is unknown
+	ErrorInvalidLintSeverity = errors.New("lint severity must be one of info, warning or error")
+)
+
+type (
+	// LintError is raised when linting a chart package finds messages at or above the severity threshold
+	LintError struct {
+		Messages []string
+	}
+)
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("chart package failed linting: %s", strings.Join(e.Messages, "; "))
+}
+
+// IsLintError determines whether or not an error is a LintError
+func IsLintError(err error) bool {
+	_, ok := err.(*LintError)
+	return ok
+}
+
+// LintSeverityFromString returns the helm lint severity of a severity threshold name, "error" if empty
+func LintSeverityFromString(name string) (int, error) {
+	if name == "" {
+		name = DefaultLintSeverity
+	}
+	severity, ok := LintSeverities[strings.ToLower(name)]
+	if !ok {
+		return 0, ErrorInvalidLintSeverity
+	}
+	return severity, nil
+}
+
+// LintChartPackage runs the helm lint rules (Chart.yaml, values.yaml and templates) on a chart package,
+// and returns a LintError with every message at or above the severity threshold, if any
+func LintChartPackage(content []byte, severity int) error {
+	return lintChartPackage(bytes.NewReader(content), severity)
+}
+
+// LintChartPackageFile runs the helm lint rules on a chart package on disk, like LintChartPackage
+func LintChartPackageFile(path string, severity int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return lintChartPackage(file, severity)
+}
+
+// lintChartPackage loads, checks and expands a chart package, rewinding it between each pass
+func lintChartPackage(archive io.ReadSeeker, severity int) error {
+	_, err := chartutil.LoadArchive(archive)
+	if err != nil {
+		return ErrorInvalidChartPackage
+	}
+
+	// helm lint rules only run on a chart directory, and chartutil.Expand writes archive entries
+	// wherever their paths point, so only packages confined to a directory are expanded
+	_, err = archive.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = checkArchivePaths(archive)
+	if err != nil {
+		return err
+	}
+	tempDirectory, err := ioutil.TempDir("", "chartmuseum-lint")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDirectory)
+	_, err = archive.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = chartutil.Expand(tempDirectory, archive)
+	if err != nil {
+		return ErrorInvalidChartPackage
+	}
+	files, err := ioutil.ReadDir(tempDirectory)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 || !files[0].IsDir() {
+		return ErrorInvalidChartPackage
+	}
+
+	linter := lint.All(pathutil.Join(tempDirectory, files[0].Name()))
+	messages := []string{}
+	for _, message := range linter.Messages {
+		if message.Severity >= severity {
+			messages = append(messages, message.Error())
+		}
+	}
+	if len(messages) > 0 {
+		return &LintError{Messages: messages}
+	}
+	return nil
+}
+
+// checkArchivePaths rejects chart packages with entries that are not regular files or directories,
+// or whose paths are absolute or contain ".."
+func checkArchivePaths(archive io.Reader) error {
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return ErrorInvalidChartPackage
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrorInvalidChartPackage
+		}
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeDir:
+		default:
+			return ErrorInvalidChartPackage
+		}
+		name := strings.Replace(header.Name, "\\", "/", -1)
+		if pathutil.IsAbs(name) {
+			return ErrorInvalidChartPackage
+		}
+		for _, part := range strings.Split(name, "/") {
+			if part == ".." {
+				return ErrorInvalidChartPackage
+			}
+		}
+	}
+}
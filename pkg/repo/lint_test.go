@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"k8s.io/helm/pkg/lint/support"
+)
+
+type LintTestSuite struct {
+	suite.Suite
+	TarballContent          []byte
+	BadTarballContent       []byte
+	TraversalTarballContent []byte
+	AbsoluteTarballContent  []byte
+	SymlinkTarballContent   []byte
+}
+
+func (suite *LintTestSuite) SetupSuite() {
+	tarballPath := "../../testdata/charts/mychart/mychart-0.1.0.tgz"
+	content, err := ioutil.ReadFile(tarballPath)
+	suite.Nil(err, "no error reading test tarball")
+	suite.TarballContent = content
+
+	suite.BadTarballContent = suite.tarball(map[string]string{
+		"badchart/Chart.yaml":          "name: badchart\nversion: latest\n",
+		"badchart/values.yaml":         "image: busybox\n",
+		"badchart/templates/pod.yaml":  "name: {{ .Release.Name }}\n",
+		"badchart/templates/_help.tpl": "{{ define \"name\" }}{{ .Chart.Name }}{{ end }}\n",
+	})
+
+	suite.TraversalTarballContent = suite.tarball(map[string]string{
+		"evilchart/Chart.yaml":                                 "name: evilchart\nversion: 0.1.0\n",
+		"evilchart/../../../../tmp/chartmuseum-lint-traversal": "written outside the chart directory\n",
+	})
+	suite.AbsoluteTarballContent = suite.tarball(map[string]string{
+		"evilchart/Chart.yaml":           "name: evilchart\nversion: 0.1.0\n",
+		"/tmp/chartmuseum-lint-absolute": "written outside the chart directory\n",
+	})
+
+	buffer := bytes.NewBuffer([]byte{})
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	chartYaml := "name: evilchart\nversion: 0.1.0\n"
+	err = tarWriter.WriteHeader(&tar.Header{Name: "evilchart/Chart.yaml", Mode: 0644, Size: int64(len(chartYaml))})
+	suite.Nil(err, "no error writing tar header")
+	_, err = tarWriter.Write([]byte(chartYaml))
+	suite.Nil(err, "no error writing tar content")
+	err = tarWriter.WriteHeader(&tar.Header{Name: "evilchart/templates", Typeflag: tar.TypeSymlink, Linkname: "/tmp", Mode: 0777})
+	suite.Nil(err, "no error writing symlink tar header")
+	suite.Nil(tarWriter.Close(), "no error closing tar writer")
+	suite.Nil(gzipWriter.Close(), "no error closing gzip writer")
+	suite.SymlinkTarballContent = buffer.Bytes()
+}
+
+func (suite *LintTestSuite) tarball(files map[string]string) []byte {
+	buffer := bytes.NewBuffer([]byte{})
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		suite.Nil(err, "no error writing tar header")
+		_, err = tarWriter.Write([]byte(content))
+		suite.Nil(err, "no error writing tar content")
+	}
+	suite.Nil(tarWriter.Close(), "no error closing tar writer")
+	suite.Nil(gzipWriter.Close(), "no error closing gzip writer")
+	return buffer.Bytes()
+}
+
+func (suite *LintTestSuite) TestLintSeverityFromString() {
+	severity, err := LintSeverityFromString("")
+	suite.Nil(err, "no error with empty severity")
+	suite.Equal(support.ErrorSev, severity, "error severity by default")
+
+	severity, err = LintSeverityFromString("Warning")
+	suite.Nil(err, "no error with warning severity")
+	suite.Equal(support.WarningSev, severity, "warning severity")
+
+	_, err = LintSeverityFromString("fatal")
+	suite.Equal(ErrorInvalidLintSeverity, err, "error with unknown severity")
+}
+
+func (suite *LintTestSuite) TestLintChartPackage() {
+	err := LintChartPackage(suite.TarballContent, support.ErrorSev)
+	suite.Nil(err, "no lint error for valid chart")
+
+	err = LintChartPackage(suite.TarballContent, support.InfoSev)
+	suite.True(IsLintError(err), "lint error for missing icon with info severity")
+
+	err = LintChartPackage(suite.BadTarballContent, support.ErrorSev)
+	suite.True(IsLintError(err), "lint error for invalid version")
+	suite.NotEmpty(err.(*LintError).Messages, "lint messages returned")
+	suite.Contains(err.Error(), "SemVer", "lint message for invalid version")
+
+	err = LintChartPackage([]byte("not a chart package"), support.ErrorSev)
+	suite.Equal(ErrorInvalidChartPackage, err, "invalid chart package")
+}
+
+func (suite *LintTestSuite) TestLintChartPackageFile() {
+	err := LintChartPackageFile("../../testdata/charts/mychart/mychart-0.1.0.tgz", support.ErrorSev)
+	suite.Nil(err, "no lint error for valid chart file")
+
+	err = LintChartPackageFile("../../testdata/charts/mychart/mychart-0.1.0.tgz", support.InfoSev)
+	suite.True(IsLintError(err), "lint error for missing icon with info severity")
+
+	err = LintChartPackageFile("../../testdata/charts/mychart/Chart.yaml", support.ErrorSev)
+	suite.Equal(ErrorInvalidChartPackage, err, "invalid chart package file")
+
+	err = LintChartPackageFile("../../testdata/charts/mychart/this-file-does-not-exist.tgz", support.ErrorSev)
+	suite.NotNil(err, "error linting missing chart package file")
+}
+
+func (suite *LintTestSuite) TestLintChartPackageOutsideDirectory() {
+	err := LintChartPackage(suite.TraversalTarballContent, support.ErrorSev)
+	suite.Equal(ErrorInvalidChartPackage, err, "invalid chart package with .. in path")
+	_, err = os.Stat("/tmp/chartmuseum-lint-traversal")
+	suite.True(os.IsNotExist(err), "no file written outside the temp directory")
+
+	err = LintChartPackage(suite.AbsoluteTarballContent, support.ErrorSev)
+	suite.Equal(ErrorInvalidChartPackage, err, "invalid chart package with absolute path")
+	_, err = os.Stat("/tmp/chartmuseum-lint-absolute")
+	suite.True(os.IsNotExist(err), "no file written at absolute path")
+
+	err = LintChartPackage(suite.SymlinkTarballContent, support.ErrorSev)
+	suite.Equal(ErrorInvalidChartPackage, err, "invalid chart package with symlink")
+}
+
+func TestLintTestSuite(t *testing.T) {
+	suite.Run(t, new(LintTestSuite))
+}
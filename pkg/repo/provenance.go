@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	pathutil "path"
 	"strings"
 
+	"github.com/ghodss/yaml"
+	"golang.org/x/crypto/openpgp/clearsign"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/provenance"
-	"regexp"
 )
 
 var (
@@ -21,29 +26,149 @@ var (
 	ErrorInvalidProvenanceFile = errors.New("invalid provenance file")
 )
 
+type (
+	// ProvenanceVerificationError is raised when a provenance file is not signed by a trusted key,
+	// or does not contain the digest of its chart package
+	ProvenanceVerificationError struct {
+		Err error
+	}
+)
+
+func (e *ProvenanceVerificationError) Error() string {
+	return fmt.Sprintf("provenance verification failed: %s", e.Err)
+}
+
+// IsProvenanceVerificationError determines whether or not an error is a ProvenanceVerificationError
+func IsProvenanceVerificationError(err error) bool {
+	_, ok := err.(*ProvenanceVerificationError)
+	return ok
+}
+
 // ProvenanceFilenameFromNameVersion returns a provenance filename from a name and version
 func ProvenanceFilenameFromNameVersion(name string, version string) string {
 	filename := fmt.Sprintf("%s-%s.%s", name, version, ProvenanceFileExtension)
 	return filename
 }
 
+// ProvenanceFilenameFromChartPackageFilename returns the provenance filename for a chart package filename
+func ProvenanceFilenameFromChartPackageFilename(filename string) string {
+	noExt := strings.TrimSuffix(filename, fmt.Sprintf(".%s", ChartPackageFileExtension))
+	filename = fmt.Sprintf("%s.%s", noExt, ProvenanceFileExtension)
+	return filename
+}
+
+// ChartPackageFilenameFromProvenanceFilename returns the chart package filename for a provenance filename
+func ChartPackageFilenameFromProvenanceFilename(filename string) string {
+	noExt := strings.TrimSuffix(filename, fmt.Sprintf(".%s", ProvenanceFileExtension))
+	filename = fmt.Sprintf("%s.%s", noExt, ChartPackageFileExtension)
+	return filename
+}
+
 // ProvenanceFilenameFromContent returns a provenance filename from binary content
 func ProvenanceFilenameFromContent(content []byte) (string, error) {
-	contentStr := string(content[:])
+	metadata, err := ChartMetadataFromProvenanceContent(content)
+	if err != nil {
+		return "", err
+	}
+	filename := ProvenanceFilenameFromNameVersion(metadata.Name, metadata.Version)
+	return filename, nil
+}
 
-	hasPGPBegin := strings.HasPrefix(contentStr, "-----BEGIN PGP SIGNED MESSAGE-----")
-	nameMatch := regexp.MustCompile("name:[ *](.+)").FindStringSubmatch(contentStr)
-	versionMatch := regexp.MustCompile("version:[ *](.+)").FindStringSubmatch(contentStr)
+// ChartMetadataFromProvenanceContent returns the metadata of the chart a provenance file is for,
+// parsed from its signed message block (without verifying the signature)
+func ChartMetadataFromProvenanceContent(content []byte) (*helm_chart.Metadata, error) {
+	block, _ := clearsign.Decode(content)
+	if block == nil {
+		return nil, ErrorInvalidProvenanceFile
+	}
+	// as written by helm: the chart metadata, then the digests of the files signed
+	parts := bytes.Split(block.Plaintext, []byte("\n...\n"))
+	if len(parts) < 2 {
+		return nil, ErrorInvalidProvenanceFile
+	}
+	metadata := &helm_chart.Metadata{}
+	err := yaml.Unmarshal(parts[0], metadata)
+	if err != nil || metadata.Name == "" || metadata.Version == "" {
+		return nil, ErrorInvalidProvenanceFile
+	}
+	return metadata, nil
+}
 
-	if !hasPGPBegin || len(nameMatch) != 2 || len(versionMatch) != 2 {
-		return "", ErrorInvalidProvenanceFile
+// VerifyProvenanceFile verifies that a provenance file is signed by a key of the keyring of a signatory,
+// and that it contains the digest of the chart package it is for
+func VerifyProvenanceFile(signatory *provenance.Signatory, content []byte, packageFilename string, packageContent []byte) error {
+	// helm only verifies files on disk, named as in the provenance file
+	tempDirectory, err := ioutil.TempDir("", "chartmuseum-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDirectory)
+	packagePath := pathutil.Join(tempDirectory, pathutil.Base(packageFilename))
+	err = ioutil.WriteFile(packagePath, packageContent, 0644)
+	if err != nil {
+		return err
+	}
+	provPath := ProvenanceFilenameFromChartPackageFilename(packagePath)
+	err = ioutil.WriteFile(provPath, content, 0644)
+	if err != nil {
+		return err
 	}
 
-	filename := ProvenanceFilenameFromNameVersion(nameMatch[1], versionMatch[1])
-	return filename, nil
+	_, err = signatory.Verify(packagePath, provPath)
+	if err != nil {
+		return &ProvenanceVerificationError{err}
+	}
+	return nil
+}
+
+// SignChartPackage generates the provenance file of a chart package, signed with the private key of a signatory
+func SignChartPackage(signatory *provenance.Signatory, packageFilename string, packageContent []byte) ([]byte, error) {
+	// helm only signs files on disk
+	tempDirectory, err := ioutil.TempDir("", "chartmuseum-sign")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDirectory)
+	packagePath := pathutil.Join(tempDirectory, pathutil.Base(packageFilename))
+	err = ioutil.WriteFile(packagePath, packageContent, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return SignChartPackageFile(signatory, packagePath)
+}
+
+// SignChartPackageFile generates the provenance file of a chart package on disk, which must be named
+// as the chart package filename, signed with the private key of a signatory
+func SignChartPackageFile(signatory *provenance.Signatory, packagePath string) ([]byte, error) {
+	signature, err := signatory.ClearSign(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(signature), nil
+}
+
+// ProvenanceFileMatchesChartPackage determines whether or not a provenance file contains the digest
+// of a chart package, without verifying its signature
+func ProvenanceFileMatchesChartPackage(content []byte, packageContent []byte) (bool, error) {
+	digest, err := provenanceDigestFromContent(packageContent)
+	if err != nil {
+		return false, err
+	}
+	return ProvenanceFileMatchesDigest(content, digest), nil
+}
+
+// ProvenanceFileMatchesDigest determines whether or not a provenance file contains a chart package digest,
+// without verifying its signature
+func ProvenanceFileMatchesDigest(content []byte, digest string) bool {
+	return bytes.Contains(content, []byte(fmt.Sprintf("sha256:%s", digest)))
 }
 
 func provenanceDigestFromContent(content []byte) (string, error) {
 	digest, err := provenance.Digest(bytes.NewBuffer(content))
 	return digest, err
 }
+
+func provenanceDigestFromFile(path string) (string, error) {
+	digest, err := provenance.DigestFile(path)
+	return digest, err
+}
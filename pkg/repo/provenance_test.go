@@ -1,9 +1,12 @@
 package repo
 
 import (
+	"bytes"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
+	"k8s.io/helm/pkg/provenance"
 )
 
 type ProvenanceTestSuite struct {
@@ -22,6 +25,32 @@ files:
   mychart-0.1.0.tgz: sha256:5c824605d676f5244aaf70d889f4e58f953308c426f2fa8f970e8fd580eaf363
 -----BEGIN PGP SIGNATURE-----
 
+wsBcBAEBCgAQBQJZuxVACRCEO7+YH8GHYgAAtVMIAEIKSyWH9hb3y/ck6Dwg2Y6v
+6i0kP3L9iCyyTp64XJYiuipdhUO/XK0CxRcLqLa0I5qu658XeU/Qxwb1GTgPoP52
+BCyiJVOY5aXl0SJa+jXHliDak7fgZjUHCtp1HBEKX2uRrx57tTkIjZr7pitt/OwI
+bRz9OXHQe9+fhtAZo5DPtMd53UQ2uRc7xft9HxnwlDEWrBfH6CUNlhbdtKRR5n0s
+FUyR0Eszw/x3No0DdPuH3fo0ShamW9eOFnXIgWqvaeSJthTC5WO5mlSGNEunJKft
+HjQLzdEWppyu55ZS6/oIJdVC2GjUa/PZmKkhYwsMvaWYv+jZWFfhZn8fPYEF0qI=
+=/cXn
+-----END PGP SIGNATURE-----`)
+	// helm sorts metadata keys, so the names of maintainers come before the name of the chart
+	goodContentWithMaintainers := []byte(`-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA512
+
+description: A chart listing maintainers
+maintainers:
+- - email: jane@example.com
+  name: Jane Doe
+- - email: john@example.com
+  name: John Doe
+name: otherchart
+version: 0.2.0
+
+...
+files:
+  otherchart-0.2.0.tgz: sha256:5c824605d676f5244aaf70d889f4e58f953308c426f2fa8f970e8fd580eaf363
+-----BEGIN PGP SIGNATURE-----
+
 wsBcBAEBCgAQBQJZuxVACRCEO7+YH8GHYgAAtVMIAEIKSyWH9hb3y/ck6Dwg2Y6v
 6i0kP3L9iCyyTp64XJYiuipdhUO/XK0CxRcLqLa0I5qu658XeU/Qxwb1GTgPoP52
 BCyiJVOY5aXl0SJa+jXHliDak7fgZjUHCtp1HBEKX2uRrx57tTkIjZr7pitt/OwI
@@ -40,6 +69,15 @@ name: mychart`)
 	suite.Nil(err, "no error getting filename from good content")
 	suite.Equal("mychart-0.1.0.tgz.prov", filename, "filename generated from good content")
 
+	filename, err = ProvenanceFilenameFromContent(goodContentWithMaintainers)
+	suite.Nil(err, "no error getting filename from good content with maintainers")
+	suite.Equal("otherchart-0.2.0.tgz.prov", filename, "filename generated from chart name, not maintainer name")
+
+	metadata, err := ChartMetadataFromProvenanceContent(goodContentWithMaintainers)
+	suite.Nil(err, "no error getting chart metadata from good content with maintainers")
+	suite.Equal(2, len(metadata.Maintainers), "maintainers parsed from good content")
+	suite.Equal("Jane Doe", metadata.Maintainers[0].Name, "maintainer name parsed from good content")
+
 	_, err = ProvenanceFilenameFromContent(badContentNoBeginPGP)
 	suite.Equal(ErrorInvalidProvenanceFile, err, "ErrorInvalidProvenanceFile from bad content, no begin pgp")
 
@@ -50,6 +88,64 @@ name: mychart`)
 	suite.Equal(ErrorInvalidProvenanceFile, err, "ErrorInvalidProvenanceFile from bad content, no version")
 }
 
+func (suite *ProvenanceTestSuite) TestProvenanceFilenameFromChartPackageFilename() {
+	filename := ProvenanceFilenameFromChartPackageFilename("mychart-0.1.0.tgz")
+	suite.Equal("mychart-0.1.0.tgz.prov", filename, "provenance filename from chart package filename")
+}
+
+func (suite *ProvenanceTestSuite) TestChartPackageFilenameFromProvenanceFilename() {
+	filename := ChartPackageFilenameFromProvenanceFilename("mychart-0.1.0.tgz.prov")
+	suite.Equal("mychart-0.1.0.tgz", filename, "chart package filename from provenance filename")
+}
+
+func (suite *ProvenanceTestSuite) TestVerifyProvenanceFile() {
+	signatory, err := provenance.NewFromKeyring("../../testdata/pgp/helm-test-key.pub", "")
+	suite.Nil(err, "no error loading test keyring")
+	packageContent, err := ioutil.ReadFile("../../testdata/charts/mychart/mychart-0.1.0.tgz")
+	suite.Nil(err, "no error reading test tarball")
+	content, err := ioutil.ReadFile("../../testdata/charts/mychart/mychart-0.1.0.tgz.prov")
+	suite.Nil(err, "no error reading test provenance file")
+
+	err = VerifyProvenanceFile(signatory, content, "mychart-0.1.0.tgz", packageContent)
+	suite.Nil(err, "no error verifying provenance file signed by trusted key")
+
+	err = VerifyProvenanceFile(signatory, content, "mychart-0.1.0.tgz", append(packageContent, 0))
+	suite.True(IsProvenanceVerificationError(err), "verification error when package digest does not match")
+
+	err = VerifyProvenanceFile(signatory, content, "mychart-0.2.0.tgz", packageContent)
+	suite.True(IsProvenanceVerificationError(err), "verification error when package is not in provenance file")
+
+	tampered := bytes.Replace(content, []byte("name: mychart"), []byte("name: yourchart"), 1)
+	err = VerifyProvenanceFile(signatory, tampered, "mychart-0.1.0.tgz", packageContent)
+	suite.True(IsProvenanceVerificationError(err), "verification error when signed message was changed")
+}
+
+func (suite *ProvenanceTestSuite) TestSignChartPackage() {
+	signer, err := provenance.NewFromKeyring("../../testdata/pgp/helm-test-key.secret", "helm-test")
+	suite.Nil(err, "no error loading test signing key")
+	verifier, err := provenance.NewFromKeyring("../../testdata/pgp/helm-test-key.pub", "")
+	suite.Nil(err, "no error loading test keyring")
+	packageContent, err := ioutil.ReadFile("../../testdata/charts/mychart/mychart-0.1.0.tgz")
+	suite.Nil(err, "no error reading test tarball")
+
+	content, err := SignChartPackage(signer, "mychart-0.1.0.tgz", packageContent)
+	suite.Nil(err, "no error signing chart package")
+	filename, err := ProvenanceFilenameFromContent(content)
+	suite.Nil(err, "no error getting filename from generated provenance file")
+	suite.Equal("mychart-0.1.0.tgz.prov", filename, "filename from generated provenance file")
+
+	err = VerifyProvenanceFile(verifier, content, "mychart-0.1.0.tgz", packageContent)
+	suite.Nil(err, "no error verifying generated provenance file")
+
+	matches, err := ProvenanceFileMatchesChartPackage(content, packageContent)
+	suite.Nil(err, "no error matching provenance file")
+	suite.True(matches, "generated provenance file matches chart package")
+
+	matches, err = ProvenanceFileMatchesChartPackage(content, append(packageContent, 0))
+	suite.Nil(err, "no error matching provenance file")
+	suite.False(matches, "generated provenance file does not match another chart package")
+}
+
 func TestProvenanceTestSuite(t *testing.T) {
 	suite.Run(t, new(ProvenanceTestSuite))
 }
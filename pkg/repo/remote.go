@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	pathutil "path"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var (
+	// RemoteRepositoryTimeout is the maximum time allowed for a request to a remote repository
+	RemoteRepositoryTimeout = 60 * time.Second
+
+	// ErrorRemoteFileNotFound is raised when a file does not exist in a remote repository
+	ErrorRemoteFileNotFound = errors.New("file not found in remote repository")
+)
+
+type (
+	// RemoteRepository is a Helm chart repository served over http(s)
+	RemoteRepository struct {
+		URL    string
+		Client *http.Client
+	}
+
+	// RemoteRepositoryError is raised when a remote repository cannot be reached or responds unexpectedly
+	RemoteRepositoryError struct {
+		URL string
+		Err error
+	}
+)
+
+func (e *RemoteRepositoryError) Error() string {
+	return fmt.Sprintf("remote repository %s: %s", e.URL, e.Err)
+}
+
+// IsRemoteRepositoryError determines whether or not an error is a RemoteRepositoryError
+func IsRemoteRepositoryError(err error) bool {
+	_, ok := err.(*RemoteRepositoryError)
+	return ok
+}
+
+// NewRemoteRepository creates a new instance of RemoteRepository
+func NewRemoteRepository(repoURL string) *RemoteRepository {
+	remote := &RemoteRepository{
+		URL:    strings.TrimSuffix(repoURL, "/"),
+		Client: &http.Client{Timeout: RemoteRepositoryTimeout},
+	}
+	return remote
+}
+
+// FetchIndex downloads and parses the index file (index.yaml) of the remote repository
+func (remote *RemoteRepository) FetchIndex() (*helm_repo.IndexFile, error) {
+	content, err := remote.Fetch(fmt.Sprintf("%s/index.yaml", remote.URL))
+	if err != nil {
+		return nil, err
+	}
+	indexFile := &helm_repo.IndexFile{}
+	err = yaml.Unmarshal(content, indexFile)
+	if err != nil {
+		return nil, &RemoteRepositoryError{URL: remote.URL, Err: err}
+	}
+	if indexFile.APIVersion == "" {
+		return nil, &RemoteRepositoryError{URL: remote.URL, Err: helm_repo.ErrNoAPIVersion}
+	}
+	if indexFile.Entries == nil {
+		indexFile.Entries = map[string]helm_repo.ChartVersions{}
+	}
+	indexFile.SortEntries()
+	return indexFile, nil
+}
+
+// ResolveURL returns the absolute url of a chart version url found in the remote index
+func (remote *RemoteRepository) ResolveURL(chartURL string) (string, error) {
+	base, err := url.Parse(fmt.Sprintf("%s/", remote.URL))
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(chartURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// Fetch downloads a file from the remote repository
+func (remote *RemoteRepository) Fetch(fileURL string) ([]byte, error) {
+	response, err := remote.Client.Get(fileURL)
+	if err != nil {
+		return nil, &RemoteRepositoryError{URL: remote.URL, Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrorRemoteFileNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %s for %s", response.Status, fileURL)
+		return nil, &RemoteRepositoryError{URL: remote.URL, Err: err}
+	}
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &RemoteRepositoryError{URL: remote.URL, Err: err}
+	}
+	return content, nil
+}
+
+// RemoteChartPackageFilename returns the chart package filename of a chart version url found in a remote index
+func RemoteChartPackageFilename(chartURL string) string {
+	if u, err := url.Parse(chartURL); err == nil {
+		chartURL = u.Path
+	}
+	return pathutil.Base(chartURL)
+}
@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RemoteRepositoryTestSuite struct {
+	suite.Suite
+	Upstream *httptest.Server
+}
+
+func (suite *RemoteRepositoryTestSuite) SetupSuite() {
+	index := NewIndex("")
+	index.AddEntry(getChartVersion("a", 0, time.Now()))
+	err := index.Regenerate()
+	suite.Nil(err, "no error regenerating index")
+
+	suite.Upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stable/index.yaml":
+			w.Write(index.Raw)
+		case "/invalid/index.yaml":
+			w.Write([]byte("entries: {}"))
+		case "/broken/index.yaml":
+			w.WriteHeader(500)
+		case "/stable/charts/a-1.0.0.tgz":
+			w.Write([]byte("content"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func (suite *RemoteRepositoryTestSuite) TearDownSuite() {
+	suite.Upstream.Close()
+}
+
+func (suite *RemoteRepositoryTestSuite) TestFetchIndex() {
+	remote := NewRemoteRepository(suite.Upstream.URL + "/stable/")
+	suite.Equal(suite.Upstream.URL+"/stable", remote.URL, "trailing slash removed from url")
+
+	indexFile, err := remote.FetchIndex()
+	suite.Nil(err, "no error fetching remote index")
+	suite.Equal(1, len(indexFile.Entries["a"]), "chart version in remote index")
+
+	_, err = NewRemoteRepository(suite.Upstream.URL + "/invalid").FetchIndex()
+	suite.True(IsRemoteRepositoryError(err), "remote repository error fetching index without api version")
+
+	_, err = NewRemoteRepository(suite.Upstream.URL + "/broken").FetchIndex()
+	suite.True(IsRemoteRepositoryError(err), "remote repository error fetching index with status 500")
+
+	_, err = NewRemoteRepository(suite.Upstream.URL + "/missing").FetchIndex()
+	suite.Equal(ErrorRemoteFileNotFound, err, "not found error fetching missing index")
+}
+
+func (suite *RemoteRepositoryTestSuite) TestFetch() {
+	remote := NewRemoteRepository(suite.Upstream.URL + "/stable")
+
+	fileURL, err := remote.ResolveURL("charts/a-1.0.0.tgz")
+	suite.Nil(err, "no error resolving relative url")
+	suite.Equal(suite.Upstream.URL+"/stable/charts/a-1.0.0.tgz", fileURL, "relative url resolved against repository url")
+
+	content, err := remote.Fetch(fileURL)
+	suite.Nil(err, "no error fetching chart package")
+	suite.Equal([]byte("content"), content, "chart package content")
+
+	_, err = remote.Fetch(suite.Upstream.URL + "/stable/charts/b-1.0.0.tgz")
+	suite.Equal(ErrorRemoteFileNotFound, err, "not found error fetching missing chart package")
+
+	fileURL, err = remote.ResolveURL("https://example.com/charts/a-1.0.0.tgz")
+	suite.Nil(err, "no error resolving absolute url")
+	suite.Equal("https://example.com/charts/a-1.0.0.tgz", fileURL, "absolute url unchanged")
+}
+
+func (suite *RemoteRepositoryTestSuite) TestRemoteChartPackageFilename() {
+	suite.Equal("a-1.0.0.tgz", RemoteChartPackageFilename("charts/a-1.0.0.tgz"), "filename of relative url")
+	suite.Equal("a-1.0.0.tgz", RemoteChartPackageFilename("https://example.com/charts/a-1.0.0.tgz?token=x"), "filename of absolute url")
+}
+
+func TestRemoteRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(RemoteRepositoryTestSuite))
+}
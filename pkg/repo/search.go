@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"sort"
+	"strings"
+
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+const (
+	// SearchScoreExactName is the score of a chart version whose name is the search query
+	SearchScoreExactName = 4
+
+	// SearchScoreNamePrefix is the score of a chart version whose name starts with the search query
+	SearchScoreNamePrefix = 3
+
+	// SearchScoreKeyword is the score of a chart version with a keyword equal to the search query
+	SearchScoreKeyword = 2
+
+	// SearchScoreText is the score of a chart version whose name, description, keywords,
+	// maintainers or sources contain the search query
+	SearchScoreText = 1
+)
+
+type searchResult struct {
+	chartVersion *helm_repo.ChartVersion
+	score        int
+	position     int
+}
+
+// Search returns the chart versions matching a query (case-insensitive), best matches first;
+// an empty query matches every chart version. If latest is true, only the latest version of each chart is considered
+func (index *Index) Search(query string, latest bool) []*helm_repo.ChartVersion {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	results := []searchResult{}
+	for _, chartVersions := range index.Entries {
+		for i, chartVersion := range chartVersions {
+			if latest && i > 0 {
+				// entries are sorted newest version first
+				break
+			}
+			score := searchScore(chartVersion, query)
+			if score > 0 {
+				results = append(results, searchResult{chartVersion, score, i})
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		if results[i].chartVersion.Name != results[j].chartVersion.Name {
+			return results[i].chartVersion.Name < results[j].chartVersion.Name
+		}
+		return results[i].position < results[j].position
+	})
+
+	chartVersions := []*helm_repo.ChartVersion{}
+	for _, result := range results {
+		chartVersions = append(chartVersions, result.chartVersion)
+	}
+	return chartVersions
+}
+
+func searchScore(chartVersion *helm_repo.ChartVersion, query string) int {
+	if query == "" {
+		return SearchScoreText
+	}
+
+	name := strings.ToLower(chartVersion.Name)
+	if name == query {
+		return SearchScoreExactName
+	}
+	if strings.HasPrefix(name, query) {
+		return SearchScoreNamePrefix
+	}
+	for _, keyword := range chartVersion.Keywords {
+		if strings.ToLower(keyword) == query {
+			return SearchScoreKeyword
+		}
+	}
+
+	text := []string{chartVersion.Name, chartVersion.Description}
+	text = append(text, chartVersion.Keywords...)
+	text = append(text, chartVersion.Sources...)
+	for _, maintainer := range chartVersion.Maintainers {
+		text = append(text, maintainer.Name, maintainer.Email)
+	}
+	for _, s := range text {
+		if strings.Contains(strings.ToLower(s), query) {
+			return SearchScoreText
+		}
+	}
+	return 0
+}
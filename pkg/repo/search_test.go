@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+type SearchTestSuite struct {
+	suite.Suite
+	Index *Index
+}
+
+func (suite *SearchTestSuite) SetupSuite() {
+	suite.Index = NewIndex("")
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		suite.Index.AddEntry(getChartVersion("redis", i, now))
+	}
+
+	chartVersion := getChartVersion("redis-ha", 0, now)
+	chartVersion.Description = "Highly available Redis cluster"
+	suite.Index.AddEntry(chartVersion)
+
+	chartVersion = getChartVersion("cache", 0, now)
+	chartVersion.Keywords = []string{"Redis", "memcached"}
+	suite.Index.AddEntry(chartVersion)
+
+	chartVersion = getChartVersion("queue", 0, now)
+	chartVersion.Maintainers = []*chart.Maintainer{{Name: "Jane", Email: "jane@redis.example.com"}}
+	suite.Index.AddEntry(chartVersion)
+
+	chartVersion = getChartVersion("web", 0, now)
+	chartVersion.Sources = []string{"https://github.com/example/web"}
+	suite.Index.AddEntry(chartVersion)
+
+	err := suite.Index.Regenerate()
+	suite.Nil(err, "no error regenerating index")
+}
+
+func (suite *SearchTestSuite) TestSearchRanking() {
+	results := suite.Index.Search("Redis", false)
+	names := []string{}
+	for _, chartVersion := range results {
+		names = append(names, chartVersion.Name)
+	}
+	suite.Equal([]string{"redis", "redis", "redis", "redis-ha", "cache", "queue"}, names,
+		"exact name, then name prefix, then keyword, then text matches")
+	suite.Equal("1.0.2", results[0].Version, "newest version of a chart first")
+}
+
+func (suite *SearchTestSuite) TestSearchLatest() {
+	results := suite.Index.Search("redis", true)
+	suite.Equal(4, len(results), "one version per chart")
+	suite.Equal("1.0.2", results[0].Version, "latest version of chart")
+}
+
+func (suite *SearchTestSuite) TestSearchFields() {
+	results := suite.Index.Search("github.com/example", false)
+	suite.Equal(1, len(results), "match on sources")
+	suite.Equal("web", results[0].Name, "chart matching sources")
+
+	results = suite.Index.Search("jane", false)
+	suite.Equal(1, len(results), "match on maintainers")
+	suite.Equal("queue", results[0].Name, "chart matching maintainers")
+
+	results = suite.Index.Search("memcached", false)
+	suite.Equal(1, len(results), "match on keywords")
+	suite.Equal("cache", results[0].Name, "chart matching keywords")
+
+	results = suite.Index.Search("nothing", false)
+	suite.Equal(0, len(results), "no match")
+
+	results = suite.Index.Search("", true)
+	suite.Equal(5, len(results), "empty query matches every chart")
+	suite.Equal("cache", results[0].Name, "charts ordered by name with empty query")
+}
+
+func TestSearchTestSuite(t *testing.T) {
+	suite.Run(t, new(SearchTestSuite))
+}
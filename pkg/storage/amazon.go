@@ -2,29 +2,57 @@ package storage
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	pathutil "path"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
-// AmazonS3Backend is a storage backend for Amazon S3
-type AmazonS3Backend struct {
-	Bucket     string
-	Client     *s3.S3
-	Downloader *s3manager.Downloader
-	Prefix     string
-	Uploader   *s3manager.Uploader
-}
+type (
+	// AmazonS3Backend is a storage backend for Amazon S3
+	AmazonS3Backend struct {
+		Bucket     string
+		Client     *s3.S3
+		Downloader *s3manager.Downloader
+		Prefix     string
+		Uploader   *s3manager.Uploader
+	}
+
+	// AmazonS3Options are connection options used to target S3-compatible services (MinIO, Ceph RGW, etc.)
+	AmazonS3Options struct {
+		Endpoint        string
+		ForcePathStyle  bool
+		DisableSSL      bool
+		AccessKeyID     string
+		SecretAccessKey string
+	}
+)
 
 // NewAmazonS3Backend creates a new instance of AmazonS3Backend
 func NewAmazonS3Backend(bucket string, prefix string, region string) *AmazonS3Backend {
-	service := s3.New(session.New(), &aws.Config{
-		Region: aws.String(region),
-	})
+	return NewAmazonS3BackendWithOptions(bucket, prefix, region, AmazonS3Options{})
+}
+
+// NewAmazonS3BackendWithOptions creates a new instance of AmazonS3Backend with custom connection options
+func NewAmazonS3BackendWithOptions(bucket string, prefix string, region string, options AmazonS3Options) *AmazonS3Backend {
+	config := &aws.Config{
+		Region:           aws.String(region),
+		S3ForcePathStyle: aws.Bool(options.ForcePathStyle),
+		DisableSSL:       aws.Bool(options.DisableSSL),
+	}
+	if options.Endpoint != "" {
+		config.Endpoint = aws.String(options.Endpoint)
+	}
+	if options.AccessKeyID != "" || options.SecretAccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(options.AccessKeyID, options.SecretAccessKey, "")
+	}
+	service := s3.New(session.New(), config)
 	b := &AmazonS3Backend{
 		Bucket:     bucket,
 		Client:     service,
@@ -35,6 +63,12 @@ func NewAmazonS3Backend(bucket string, prefix string, region string) *AmazonS3Ba
 	return b
 }
 
+// WithPrefix returns a backend for a sub-prefix of prefix in the same Amazon S3 bucket
+func (b AmazonS3Backend) WithPrefix(prefix string) Backend {
+	b.Prefix = cleanPrefix(pathutil.Join(b.Prefix, prefix))
+	return &b
+}
+
 // ListObjects lists all objects in Amazon S3 bucket, at prefix
 func (b AmazonS3Backend) ListObjects() ([]Object, error) {
 	var objects []Object
@@ -45,7 +79,7 @@ func (b AmazonS3Backend) ListObjects() ([]Object, error) {
 	for {
 		s3Result, err := b.Client.ListObjects(s3Input)
 		if err != nil {
-			return objects, err
+			return objects, backendError(err, false)
 		}
 		for _, obj := range s3Result.Contents {
 			path := removePrefixFromObjectPath(b.Prefix, *obj.Key)
@@ -78,11 +112,12 @@ func (b AmazonS3Backend) GetObject(path string) (Object, error) {
 	}
 	s3Result, err := b.Client.GetObject(s3Input)
 	if err != nil {
-		return object, err
+		return object, amazonBackendError(err)
 	}
 	content, err = ioutil.ReadAll(s3Result.Body)
+	s3Result.Body.Close()
 	if err != nil {
-		return object, err
+		return object, backendError(err, false)
 	}
 	object.Content = content
 	object.LastModified = *s3Result.LastModified
@@ -97,7 +132,41 @@ func (b AmazonS3Backend) PutObject(path string, content []byte) error {
 		Body:   bytes.NewBuffer(content),
 	}
 	_, err := b.Uploader.Upload(s3Input)
-	return err
+	return backendError(err, false)
+}
+
+// GetObjectStream opens an object in Amazon S3 bucket, at prefix, for reading
+func (b AmazonS3Backend) GetObjectStream(path string) (*ObjectStream, error) {
+	s3Input := &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(pathutil.Join(b.Prefix, path)),
+	}
+	s3Result, err := b.Client.GetObject(s3Input)
+	if err != nil {
+		return nil, amazonBackendError(err)
+	}
+	size := int64(-1)
+	if s3Result.ContentLength != nil {
+		size = *s3Result.ContentLength
+	}
+	stream := &ObjectStream{
+		ReadCloser:   s3Result.Body,
+		Path:         path,
+		Size:         size,
+		LastModified: aws.TimeValue(s3Result.LastModified),
+	}
+	return stream, nil
+}
+
+// PutObjectStream uploads an object to Amazon S3 bucket, at prefix, from a stream
+func (b AmazonS3Backend) PutObjectStream(path string, content io.Reader) error {
+	s3Input := &s3manager.UploadInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(pathutil.Join(b.Prefix, path)),
+		Body:   content,
+	}
+	_, err := b.Uploader.Upload(s3Input)
+	return backendError(err, false)
 }
 
 // DeleteObject removes an object from Amazon S3 bucket, at prefix
@@ -107,5 +176,13 @@ func (b AmazonS3Backend) DeleteObject(path string) error {
 		Key:    aws.String(pathutil.Join(b.Prefix, path)),
 	}
 	_, err := b.Client.DeleteObject(s3Input)
-	return err
+	return amazonBackendError(err)
+}
+
+func amazonBackendError(err error) error {
+	notFound := false
+	if awsErr, ok := err.(awserr.Error); ok {
+		notFound = awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound"
+	}
+	return backendError(err, notFound)
 }
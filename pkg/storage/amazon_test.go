@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -13,13 +14,31 @@ type AmazonTestSuite struct {
 	NoPrefixAmazonS3Backend *AmazonS3Backend
 }
 
+// newTestAmazonS3Backend targets a local S3-compatible service (e.g. MinIO) if TEST_STORAGE_AMAZON_ENDPOINT is set
+func newTestAmazonS3Backend(bucket string, prefix string, region string) *AmazonS3Backend {
+	endpoint := os.Getenv("TEST_STORAGE_AMAZON_ENDPOINT")
+	if endpoint == "" {
+		return NewAmazonS3Backend(bucket, prefix, region)
+	}
+	return NewAmazonS3BackendWithOptions(bucket, prefix, region, AmazonS3Options{
+		Endpoint:        endpoint,
+		ForcePathStyle:  true,
+		AccessKeyID:     os.Getenv("TEST_STORAGE_AMAZON_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("TEST_STORAGE_AMAZON_SECRET_ACCESS_KEY"),
+	})
+}
+
+func amazonStorageTestsEnabled() bool {
+	return os.Getenv("TEST_CLOUD_STORAGE") == "1" || os.Getenv("TEST_STORAGE_AMAZON_ENDPOINT") != ""
+}
+
 func (suite *AmazonTestSuite) SetupSuite() {
-	backend := NewAmazonS3Backend("fake-bucket-cant-exist-fbce123", "", "us-east-1")
+	s3Region := os.Getenv("TEST_STORAGE_AMAZON_REGION")
+	backend := newTestAmazonS3Backend("fake-bucket-cant-exist-fbce123", "", s3Region)
 	suite.BrokenAmazonS3Backend = backend
 
 	s3Bucket := os.Getenv("TEST_STORAGE_AMAZON_BUCKET")
-	s3Region := os.Getenv("TEST_STORAGE_AMAZON_REGION")
-	backend = NewAmazonS3Backend(s3Bucket, "", s3Region)
+	backend = newTestAmazonS3Backend(s3Bucket, "", s3Region)
 	suite.NoPrefixAmazonS3Backend = backend
 
 	data := []byte("some object")
@@ -51,8 +70,18 @@ func (suite *AmazonTestSuite) TestPutObject() {
 	suite.NotNil(err, "cannot put objects with bad bucket")
 }
 
+func (suite *AmazonTestSuite) TestGetObjectStream() {
+	_, err := suite.BrokenAmazonS3Backend.GetObjectStream("this-file-cannot-possibly-exist.tgz")
+	suite.NotNil(err, "cannot get object stream with bad bucket")
+}
+
+func (suite *AmazonTestSuite) TestPutObjectStream() {
+	err := suite.BrokenAmazonS3Backend.PutObjectStream("this-file-will-not-upload.txt", bytes.NewReader([]byte{}))
+	suite.NotNil(err, "cannot put object stream with bad bucket")
+}
+
 func TestAmazonStorageTestSuite(t *testing.T) {
-	if os.Getenv("TEST_CLOUD_STORAGE") == "1" {
+	if amazonStorageTestsEnabled() {
 		suite.Run(t, new(AmazonTestSuite))
 	}
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"io"
 	"io/ioutil"
 	pathutil "path"
 
@@ -36,6 +37,13 @@ func NewGoogleCSBackend(bucket string, prefix string) *GoogleCSBackend {
 	return b
 }
 
+// WithPrefix returns a backend for a sub-prefix of prefix in the same Google Cloud Storage bucket
+func (b GoogleCSBackend) WithPrefix(prefix string) Backend {
+	b.Prefix = cleanPrefix(pathutil.Join(b.Prefix, prefix))
+	b.Query = &storage.Query{Prefix: b.Prefix}
+	return &b
+}
+
 // ListObjects lists all objects in Google Cloud Storage bucket, at prefix
 func (b GoogleCSBackend) ListObjects() ([]Object, error) {
 	var objects []Object
@@ -46,7 +54,7 @@ func (b GoogleCSBackend) ListObjects() ([]Object, error) {
 			break
 		}
 		if err != nil {
-			return objects, err
+			return objects, backendError(err, false)
 		}
 		path := removePrefixFromObjectPath(b.Prefix, attrs.Name)
 		if objectPathIsInvalid(path) {
@@ -69,17 +77,17 @@ func (b GoogleCSBackend) GetObject(path string) (Object, error) {
 	objectHandle := b.Client.Object(pathutil.Join(b.Prefix, path))
 	attrs, err := objectHandle.Attrs(b.Context)
 	if err != nil {
-		return object, err
+		return object, googleBackendError(err)
 	}
 	object.LastModified = attrs.Updated
 	rc, err := objectHandle.NewReader(b.Context)
 	if err != nil {
-		return object, err
+		return object, googleBackendError(err)
 	}
 	content, err := ioutil.ReadAll(rc)
 	rc.Close()
 	if err != nil {
-		return object, err
+		return object, backendError(err, false)
 	}
 	object.Content = content
 	return object, nil
@@ -90,14 +98,50 @@ func (b GoogleCSBackend) PutObject(path string, content []byte) error {
 	wc := b.Client.Object(pathutil.Join(b.Prefix, path)).NewWriter(b.Context)
 	_, err := wc.Write(content)
 	if err != nil {
-		return err
+		return backendError(err, false)
+	}
+	err = wc.Close()
+	return backendError(err, false)
+}
+
+// GetObjectStream opens an object in Google Cloud Storage bucket, at prefix, for reading
+func (b GoogleCSBackend) GetObjectStream(path string) (*ObjectStream, error) {
+	objectHandle := b.Client.Object(pathutil.Join(b.Prefix, path))
+	attrs, err := objectHandle.Attrs(b.Context)
+	if err != nil {
+		return nil, googleBackendError(err)
+	}
+	rc, err := objectHandle.NewReader(b.Context)
+	if err != nil {
+		return nil, googleBackendError(err)
+	}
+	stream := &ObjectStream{
+		ReadCloser:   rc,
+		Path:         path,
+		Size:         attrs.Size,
+		LastModified: attrs.Updated,
+	}
+	return stream, nil
+}
+
+// PutObjectStream uploads an object to Google Cloud Storage bucket, at prefix, from a stream
+func (b GoogleCSBackend) PutObjectStream(path string, content io.Reader) error {
+	wc := b.Client.Object(pathutil.Join(b.Prefix, path)).NewWriter(b.Context)
+	_, err := io.Copy(wc, content)
+	if err != nil {
+		wc.CloseWithError(err)
+		return backendError(err, false)
 	}
 	err = wc.Close()
-	return err
+	return backendError(err, false)
 }
 
 // DeleteObject removes an object from Google Cloud Storage bucket, at prefix
 func (b GoogleCSBackend) DeleteObject(path string) error {
 	err := b.Client.Object(pathutil.Join(b.Prefix, path)).Delete(b.Context)
-	return err
+	return googleBackendError(err)
+}
+
+func googleBackendError(err error) error {
+	return backendError(err, err == storage.ErrObjectNotExist)
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -50,6 +51,16 @@ func (suite *GoogleTestSuite) TestPutObject() {
 	suite.NotNil(err, "cannot put objects with bad bucket")
 }
 
+func (suite *GoogleTestSuite) TestGetObjectStream() {
+	_, err := suite.BrokenGoogleCSBackend.GetObjectStream("this-file-cannot-possibly-exist.tgz")
+	suite.NotNil(err, "cannot get object stream with bad bucket")
+}
+
+func (suite *GoogleTestSuite) TestPutObjectStream() {
+	err := suite.BrokenGoogleCSBackend.PutObjectStream("this-file-will-not-upload.txt", bytes.NewReader([]byte{}))
+	suite.NotNil(err, "cannot put object stream with bad bucket")
+}
+
 func TestGoogleStorageTestSuite(t *testing.T) {
 	if os.Getenv("TEST_CLOUD_STORAGE") == "1" {
 		suite.Run(t, new(GoogleTestSuite))
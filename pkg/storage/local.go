@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 
@@ -10,6 +11,9 @@ import (
 // LocalFilesystemBackend is a storage backend for local filesystem storage
 type LocalFilesystemBackend struct {
 	RootDirectory string
+	// createOnWrite is set for backends scoped to a subdirectory, which is only created
+	// when an object is first written to it
+	createOnWrite bool
 }
 
 // NewLocalFilesystemBackend creates a new instance of LocalFilesystemBackend
@@ -24,12 +28,21 @@ func NewLocalFilesystemBackend(rootDirectory string) *LocalFilesystemBackend {
 	return b
 }
 
+// WithPrefix returns a backend for a subdirectory of root directory
+func (b LocalFilesystemBackend) WithPrefix(prefix string) Backend {
+	return &LocalFilesystemBackend{RootDirectory: pathutil.Join(b.RootDirectory, prefix), createOnWrite: true}
+}
+
 // ListObjects lists all objects in root directory (depth 1)
 func (b LocalFilesystemBackend) ListObjects() ([]Object, error) {
 	var objects []Object
 	files, err := ioutil.ReadDir(b.RootDirectory)
 	if err != nil {
-		return objects, err
+		if b.createOnWrite && os.IsNotExist(err) {
+			// nothing written under the prefix yet
+			return objects, nil
+		}
+		return objects, backendError(err, false)
 	}
 	for _, f := range files {
 		if f.IsDir() {
@@ -48,27 +61,85 @@ func (b LocalFilesystemBackend) GetObject(path string) (Object, error) {
 	fullpath := pathutil.Join(b.RootDirectory, path)
 	content, err := ioutil.ReadFile(fullpath)
 	if err != nil {
-		return object, err
+		return object, localBackendError(err)
 	}
 	object.Content = content
 	info, err := os.Stat(fullpath)
 	if err != nil {
-		return object, err
+		return object, localBackendError(err)
 	}
 	object.LastModified = info.ModTime()
-	return object, err
+	return object, nil
 }
 
 // PutObject puts an object in root directory
 func (b LocalFilesystemBackend) PutObject(path string, content []byte) error {
+	err := b.createRootDirectory()
+	if err != nil {
+		return backendError(err, false)
+	}
+	fullpath := pathutil.Join(b.RootDirectory, path)
+	err = ioutil.WriteFile(fullpath, content, 0644)
+	return backendError(err, false)
+}
+
+// GetObjectStream opens an object in root directory for reading
+func (b LocalFilesystemBackend) GetObjectStream(path string) (*ObjectStream, error) {
+	fullpath := pathutil.Join(b.RootDirectory, path)
+	file, err := os.Open(fullpath)
+	if err != nil {
+		return nil, localBackendError(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, localBackendError(err)
+	}
+	stream := &ObjectStream{
+		ReadCloser:   file,
+		Path:         path,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}
+	return stream, nil
+}
+
+// PutObjectStream writes an object in root directory from a stream
+func (b LocalFilesystemBackend) PutObjectStream(path string, content io.Reader) error {
+	err := b.createRootDirectory()
+	if err != nil {
+		return backendError(err, false)
+	}
 	fullpath := pathutil.Join(b.RootDirectory, path)
-	err := ioutil.WriteFile(fullpath, content, 0644)
-	return err
+	file, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return backendError(err, false)
+	}
+	_, err = io.Copy(file, content)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fullpath)
+	}
+	return backendError(err, false)
 }
 
 // DeleteObject removes an object from root directory
 func (b LocalFilesystemBackend) DeleteObject(path string) error {
 	fullpath := pathutil.Join(b.RootDirectory, path)
 	err := os.Remove(fullpath)
-	return err
+	return localBackendError(err)
+}
+
+func (b LocalFilesystemBackend) createRootDirectory() error {
+	if !b.createOnWrite {
+		return nil
+	}
+	return os.MkdirAll(b.RootDirectory, 0777)
+}
+
+func localBackendError(err error) error {
+	return backendError(err, os.IsNotExist(err))
 }
@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	pathutil "path"
 	"testing"
 	"time"
 
@@ -26,11 +28,46 @@ func (suite *LocalTestSuite) SetupSuite() {
 func (suite *LocalTestSuite) TestListObjects() {
 	_, err := suite.LocalFilesystemBackend.ListObjects()
 	suite.NotNil(err, "cannot list objects with bad root dir")
+	suite.True(IsBackendUnavailableError(err), "BackendUnavailableError listing objects with bad root dir")
 }
 
 func (suite *LocalTestSuite) TestGetObject() {
 	_, err := suite.LocalFilesystemBackend.GetObject("this-file-cannot-possibly-exist.tgz")
-	suite.NotNil(err, "cannot get objects with bad path")
+	suite.Equal(ErrorObjectNotFound, err, "ErrorObjectNotFound getting object with bad path")
+}
+
+func (suite *LocalTestSuite) TestGetObjectStream() {
+	_, err := suite.LocalFilesystemBackend.GetObjectStream("this-file-cannot-possibly-exist.tgz")
+	suite.Equal(ErrorObjectNotFound, err, "ErrorObjectNotFound getting object stream with bad path")
+}
+
+func (suite *LocalTestSuite) TestPutObjectStream() {
+	err := suite.LocalFilesystemBackend.PutObjectStream("this-file-will-not-upload.txt", bytes.NewReader([]byte{}))
+	suite.NotNil(err, "cannot put object stream with bad root dir")
+}
+
+func (suite *LocalTestSuite) TestDeleteObject() {
+	err := suite.LocalFilesystemBackend.DeleteObject("this-file-cannot-possibly-exist.tgz")
+	suite.Equal(ErrorObjectNotFound, err, "ErrorObjectNotFound deleting object with bad path")
+}
+
+func (suite *LocalTestSuite) TestWithPrefix() {
+	timestamp := time.Now().Format("20060102150405")
+	rootDirectory := fmt.Sprintf("../../.test/storage-local/%s-prefixed", timestamp)
+	defer os.RemoveAll(rootDirectory)
+	backend := NewLocalFilesystemBackend(rootDirectory).WithPrefix("org1/repo1")
+
+	objects, err := backend.ListObjects()
+	suite.Nil(err, "no error listing objects under a prefix never written to")
+	suite.Empty(objects, "no objects under a prefix never written to")
+	_, err = os.Stat(pathutil.Join(rootDirectory, "org1"))
+	suite.True(os.IsNotExist(err), "prefix directory not created until written to")
+
+	err = backend.PutObject("mychart-0.1.0.tgz", []byte("content"))
+	suite.Nil(err, "no error putting object under a new prefix")
+	objects, err = backend.ListObjects()
+	suite.Nil(err, "no error listing objects under prefix")
+	suite.Equal(1, len(objects), "object listed under prefix")
 }
 
 func TestLocalStorageTestSuite(t *testing.T) {
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	pathutil "path"
+	"time"
+
+	microsoft_storage "github.com/Azure/azure-sdk-for-go/storage"
+)
+
+// MicrosoftBlobBackend is a storage backend for Microsoft Azure Blob Storage
+type MicrosoftBlobBackend struct {
+	Prefix    string
+	Container *microsoft_storage.Container
+}
+
+// NewMicrosoftBlobBackend creates a new instance of MicrosoftBlobBackend
+func NewMicrosoftBlobBackend(account string, accessKey string, container string, prefix string) *MicrosoftBlobBackend {
+	client, err := microsoft_storage.NewBasicClient(account, accessKey)
+	if err != nil {
+		panic(err)
+	}
+	return newMicrosoftBlobBackendFromClient(client, container, prefix)
+}
+
+// NewMicrosoftBlobEmulatorBackend creates a new instance of MicrosoftBlobBackend using the local storage emulator (Azurite)
+func NewMicrosoftBlobEmulatorBackend(container string, prefix string) *MicrosoftBlobBackend {
+	client, err := microsoft_storage.NewEmulatorClient()
+	if err != nil {
+		panic(err)
+	}
+	return newMicrosoftBlobBackendFromClient(client, container, prefix)
+}
+
+func newMicrosoftBlobBackendFromClient(client microsoft_storage.Client, container string, prefix string) *MicrosoftBlobBackend {
+	blobClient := client.GetBlobService()
+	b := &MicrosoftBlobBackend{
+		Prefix:    cleanPrefix(prefix),
+		Container: blobClient.GetContainerReference(container),
+	}
+	return b
+}
+
+// WithPrefix returns a backend for a sub-prefix of prefix in the same Microsoft Azure Blob Storage container
+func (b MicrosoftBlobBackend) WithPrefix(prefix string) Backend {
+	b.Prefix = cleanPrefix(pathutil.Join(b.Prefix, prefix))
+	return &b
+}
+
+// ListObjects lists all objects in Microsoft Azure Blob Storage container, at prefix
+func (b MicrosoftBlobBackend) ListObjects() ([]Object, error) {
+	var objects []Object
+	params := microsoft_storage.ListBlobsParameters{
+		Prefix:     b.Prefix,
+		MaxResults: 5000,
+	}
+	for {
+		response, err := b.Container.ListBlobs(params)
+		if err != nil {
+			return objects, backendError(err, false)
+		}
+		for _, blob := range response.Blobs {
+			path := removePrefixFromObjectPath(b.Prefix, blob.Name)
+			if objectPathIsInvalid(path) {
+				continue
+			}
+			object := Object{
+				Path:         path,
+				Content:      []byte{},
+				LastModified: time.Time(blob.Properties.LastModified),
+			}
+			objects = append(objects, object)
+		}
+		if response.NextMarker == "" {
+			break
+		}
+		params.Marker = response.NextMarker
+	}
+	return objects, nil
+}
+
+// GetObject retrieves an object from Microsoft Azure Blob Storage container, at prefix
+func (b MicrosoftBlobBackend) GetObject(path string) (Object, error) {
+	var object Object
+	object.Path = path
+	stream, err := b.GetObjectStream(path)
+	if err != nil {
+		return object, err
+	}
+	content, err := ioutil.ReadAll(stream)
+	stream.Close()
+	if err != nil {
+		return object, backendError(err, false)
+	}
+	object.Content = content
+	object.LastModified = stream.LastModified
+	return object, nil
+}
+
+// PutObject uploads an object to Microsoft Azure Blob Storage container, at prefix
+func (b MicrosoftBlobBackend) PutObject(path string, content []byte) error {
+	return b.PutObjectStream(path, bytes.NewReader(content))
+}
+
+// GetObjectStream opens an object in Microsoft Azure Blob Storage container, at prefix, for reading
+func (b MicrosoftBlobBackend) GetObjectStream(path string) (*ObjectStream, error) {
+	blob := b.Container.GetBlobReference(pathutil.Join(b.Prefix, path))
+	err := blob.GetProperties(nil)
+	if err != nil {
+		return nil, microsoftBackendError(err)
+	}
+	rc, err := blob.Get(nil)
+	if err != nil {
+		return nil, microsoftBackendError(err)
+	}
+	stream := &ObjectStream{
+		ReadCloser:   rc,
+		Path:         path,
+		Size:         blob.Properties.ContentLength,
+		LastModified: time.Time(blob.Properties.LastModified),
+	}
+	return stream, nil
+}
+
+// PutObjectStream uploads an object to Microsoft Azure Blob Storage container, at prefix, from a stream
+func (b MicrosoftBlobBackend) PutObjectStream(path string, content io.Reader) error {
+	blob := b.Container.GetBlobReference(pathutil.Join(b.Prefix, path))
+	err := blob.CreateBlockBlobFromReader(content, nil)
+	return backendError(err, false)
+}
+
+// DeleteObject removes an object from Microsoft Azure Blob Storage container, at prefix
+func (b MicrosoftBlobBackend) DeleteObject(path string) error {
+	blob := b.Container.GetBlobReference(pathutil.Join(b.Prefix, path))
+	err := blob.Delete(nil)
+	return microsoftBackendError(err)
+}
+
+func microsoftBackendError(err error) error {
+	notFound := false
+	switch azErr := err.(type) {
+	case microsoft_storage.AzureStorageServiceError:
+		notFound = azErr.StatusCode == http.StatusNotFound
+	case *microsoft_storage.AzureStorageServiceError:
+		notFound = azErr.StatusCode == http.StatusNotFound
+	}
+	return backendError(err, notFound)
+}
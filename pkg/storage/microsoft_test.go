@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MicrosoftTestSuite struct {
+	suite.Suite
+	BrokenMicrosoftBlobBackend   *MicrosoftBlobBackend
+	NoPrefixMicrosoftBlobBackend *MicrosoftBlobBackend
+}
+
+func newTestMicrosoftBlobBackend(container string, prefix string) *MicrosoftBlobBackend {
+	if os.Getenv("TEST_STORAGE_MICROSOFT_EMULATOR") == "1" {
+		return NewMicrosoftBlobEmulatorBackend(container, prefix)
+	}
+	account := os.Getenv("TEST_STORAGE_MICROSOFT_ACCOUNT")
+	accessKey := os.Getenv("TEST_STORAGE_MICROSOFT_ACCESS_KEY")
+	return NewMicrosoftBlobBackend(account, accessKey, container, prefix)
+}
+
+func microsoftStorageTestsEnabled() bool {
+	return os.Getenv("TEST_CLOUD_STORAGE") == "1" || os.Getenv("TEST_STORAGE_MICROSOFT_EMULATOR") == "1"
+}
+
+func (suite *MicrosoftTestSuite) SetupSuite() {
+	backend := newTestMicrosoftBlobBackend("fake-container-cant-exist-fbce123", "")
+	suite.BrokenMicrosoftBlobBackend = backend
+
+	container := os.Getenv("TEST_STORAGE_MICROSOFT_CONTAINER")
+	backend = newTestMicrosoftBlobBackend(container, "")
+	suite.NoPrefixMicrosoftBlobBackend = backend
+
+	_, err := suite.NoPrefixMicrosoftBlobBackend.Container.CreateIfNotExists(nil)
+	suite.Nil(err, "no error creating container using MicrosoftBlob backend")
+
+	data := []byte("some object")
+	path := "deleteme.txt"
+	err = suite.NoPrefixMicrosoftBlobBackend.PutObject(path, data)
+	suite.Nil(err, "no error putting deleteme.txt using MicrosoftBlob backend")
+}
+
+func (suite *MicrosoftTestSuite) TearDownSuite() {
+	err := suite.NoPrefixMicrosoftBlobBackend.DeleteObject("deleteme.txt")
+	suite.Nil(err, "no error deleting deleteme.txt using MicrosoftBlob backend")
+}
+
+func (suite *MicrosoftTestSuite) TestListObjects() {
+	_, err := suite.BrokenMicrosoftBlobBackend.ListObjects()
+	suite.NotNil(err, "cannot list objects with bad container")
+
+	_, err = suite.NoPrefixMicrosoftBlobBackend.ListObjects()
+	suite.Nil(err, "can list objects with good container, no prefix")
+}
+
+func (suite *MicrosoftTestSuite) TestGetObject() {
+	_, err := suite.BrokenMicrosoftBlobBackend.GetObject("this-file-cannot-possibly-exist.tgz")
+	suite.NotNil(err, "cannot get objects with bad container")
+}
+
+func (suite *MicrosoftTestSuite) TestPutObject() {
+	err := suite.BrokenMicrosoftBlobBackend.PutObject("this-file-will-not-upload.txt", []byte{})
+	suite.NotNil(err, "cannot put objects with bad container")
+}
+
+func (suite *MicrosoftTestSuite) TestGetObjectStream() {
+	_, err := suite.BrokenMicrosoftBlobBackend.GetObjectStream("this-file-cannot-possibly-exist.tgz")
+	suite.NotNil(err, "cannot get object stream with bad container")
+}
+
+func (suite *MicrosoftTestSuite) TestPutObjectStream() {
+	err := suite.BrokenMicrosoftBlobBackend.PutObjectStream("this-file-will-not-upload.txt", bytes.NewReader([]byte{}))
+	suite.NotNil(err, "cannot put object stream with bad container")
+}
+
+func TestMicrosoftStorageTestSuite(t *testing.T) {
+	if microsoftStorageTestsEnabled() {
+		suite.Run(t, new(MicrosoftTestSuite))
+	}
+}
@@ -1,12 +1,22 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
+var (
+	// ErrorObjectNotFound is returned when an object does not exist in storage
+	ErrorObjectNotFound = errors.New("object not found")
+
+	// ErrorObjectAlreadyExists is returned when an object to be created already exists in storage
+	ErrorObjectAlreadyExists = errors.New("object already exists")
+)
+
 type (
 	// Object is a generic representation of a storage object
 	Object struct {
@@ -30,8 +40,45 @@ type (
 		PutObject(path string, content []byte) error
 		DeleteObject(path string) error
 	}
+
+	// ObjectStream is a storage object whose content is read from an open stream (Size is -1 if unknown)
+	ObjectStream struct {
+		io.ReadCloser
+		Path         string
+		Size         int64
+		LastModified time.Time
+	}
+
+	// StreamingBackend is a storage backend able to read and write objects without holding them in memory
+	StreamingBackend interface {
+		Backend
+		GetObjectStream(path string) (*ObjectStream, error)
+		PutObjectStream(path string, content io.Reader) error
+	}
+
+	// PrefixedBackend is a storage backend able to create a copy of itself scoped to a sub-prefix
+	PrefixedBackend interface {
+		Backend
+		WithPrefix(prefix string) Backend
+	}
+
+	// BackendUnavailableError is returned when a storage backend fails for a reason unrelated
+	// to the object requested (network, credentials, permissions, etc.)
+	BackendUnavailableError struct {
+		Err error
+	}
 )
 
+func (e *BackendUnavailableError) Error() string {
+	return fmt.Sprintf("storage backend unavailable: %s", e.Err)
+}
+
+// IsBackendUnavailableError determines whether or not an error is a BackendUnavailableError
+func IsBackendUnavailableError(err error) bool {
+	_, ok := err.(*BackendUnavailableError)
+	return ok
+}
+
 // HasExtension determines whether or not an object contains a file extension
 func (object Object) HasExtension(extension string) bool {
 	return filepath.Ext(object.Path) == fmt.Sprintf(".%s", extension)
@@ -45,7 +92,7 @@ func GetObjectSliceDiff(os1 []Object, os2 []Object) ObjectSliceDiff {
 		for _, o2 := range os2 {
 			if o1.Path == o2.Path {
 				found = true
-				if o1.LastModified != o2.LastModified {
+				if !o1.LastModified.Equal(o2.LastModified) {
 					diff.Updated = append(diff.Updated, o2)
 				}
 				break
@@ -71,6 +118,17 @@ func GetObjectSliceDiff(os1 []Object, os2 []Object) ObjectSliceDiff {
 	return diff
 }
 
+// backendError converts an error returned by a storage client into ErrorObjectNotFound or a BackendUnavailableError
+func backendError(err error, notFound bool) error {
+	if err == nil {
+		return nil
+	}
+	if notFound {
+		return ErrorObjectNotFound
+	}
+	return &BackendUnavailableError{Err: err}
+}
+
 func cleanPrefix(prefix string) string {
 	return strings.Trim(prefix, "/")
 }
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 	"time"
@@ -25,14 +27,27 @@ func (suite *StorageTestSuite) setupStorageBackends() {
 	err := os.MkdirAll(fmt.Sprintf("%s/%s", suite.TempDirectory, "ignoreme"), 0777)
 	suite.Nil(err, "No error creating ignored dir in local storage")
 
-	if os.Getenv("TEST_CLOUD_STORAGE") == "1" {
+	if amazonStorageTestsEnabled() {
 		prefix := fmt.Sprintf("unittest/%s", timestamp)
 		s3Bucket := os.Getenv("TEST_STORAGE_AMAZON_BUCKET")
 		s3Region := os.Getenv("TEST_STORAGE_AMAZON_REGION")
+		suite.StorageBackends["AmazonS3"] = Backend(newTestAmazonS3Backend(s3Bucket, prefix, s3Region))
+	}
+
+	if os.Getenv("TEST_CLOUD_STORAGE") == "1" {
+		prefix := fmt.Sprintf("unittest/%s", timestamp)
 		gcsBucket := os.Getenv("TEST_STORAGE_GOOGLE_BUCKET")
-		suite.StorageBackends["AmazonS3"] = Backend(NewAmazonS3Backend(s3Bucket, prefix, s3Region))
 		suite.StorageBackends["GoogleCS"] = Backend(NewGoogleCSBackend(gcsBucket, prefix))
 	}
+
+	if microsoftStorageTestsEnabled() {
+		prefix := fmt.Sprintf("unittest/%s", timestamp)
+		container := os.Getenv("TEST_STORAGE_MICROSOFT_CONTAINER")
+		backend := newTestMicrosoftBlobBackend(container, prefix)
+		_, err := backend.Container.CreateIfNotExists(nil)
+		suite.Nil(err, "no error creating container for MicrosoftBlob backend")
+		suite.StorageBackends["MicrosoftBlob"] = Backend(backend)
+	}
 }
 
 func (suite *StorageTestSuite) SetupSuite() {
@@ -112,6 +127,101 @@ func (suite *StorageTestSuite) TestGetObject() {
 	}
 }
 
+func (suite *StorageTestSuite) TestGetObjectNotFound() {
+	for key, backend := range suite.StorageBackends {
+		_, err := backend.GetObject("this-file-cannot-possibly-exist.tgz")
+		message := fmt.Sprintf("ErrorObjectNotFound getting missing object using %s backend", key)
+		suite.Equal(ErrorObjectNotFound, err, message)
+	}
+}
+
+func (suite *StorageTestSuite) TestGetObjectStream() {
+	for key, backend := range suite.StorageBackends {
+		streamingBackend, ok := backend.(StreamingBackend)
+		message := fmt.Sprintf("%s backend supports streaming", key)
+		suite.True(ok, message)
+		if !ok {
+			continue
+		}
+		for i := 1; i <= 9; i++ {
+			path := fmt.Sprintf("test%d.txt", i)
+			expectedContent := []byte(fmt.Sprintf("test content %d", i))
+			stream, err := streamingBackend.GetObjectStream(path)
+			message = fmt.Sprintf("no error opening object stream %s using %s backend", path, key)
+			suite.Nil(err, message)
+			if err != nil {
+				continue
+			}
+			content, err := ioutil.ReadAll(stream)
+			stream.Close()
+			message = fmt.Sprintf("no error reading object stream %s using %s backend", path, key)
+			suite.Nil(err, message)
+			message = fmt.Sprintf("object stream %s content as expected using %s backend", path, key)
+			suite.Equal(expectedContent, content, message)
+			message = fmt.Sprintf("object stream %s size as expected using %s backend", path, key)
+			suite.Equal(int64(len(expectedContent)), stream.Size, message)
+			message = fmt.Sprintf("object stream %s path as expected using %s backend", path, key)
+			suite.Equal(path, stream.Path, message)
+		}
+	}
+}
+
+func (suite *StorageTestSuite) TestPutObjectStream() {
+	for key, backend := range suite.StorageBackends {
+		streamingBackend, ok := backend.(StreamingBackend)
+		if !ok {
+			continue
+		}
+		data := []byte("streamed content")
+		path := "streamed.txt"
+		err := streamingBackend.PutObjectStream(path, bytes.NewReader(data))
+		message := fmt.Sprintf("no error putting object stream %s using %s backend", path, key)
+		suite.Nil(err, message)
+		object, err := backend.GetObject(path)
+		message = fmt.Sprintf("no error getting streamed object %s using %s backend", path, key)
+		suite.Nil(err, message)
+		message = fmt.Sprintf("streamed object %s content as expected using %s backend", path, key)
+		suite.Equal(data, object.Content, message)
+		err = backend.DeleteObject(path)
+		message = fmt.Sprintf("no error deleting streamed object %s using %s backend", path, key)
+		suite.Nil(err, message)
+	}
+}
+
+func (suite *StorageTestSuite) TestWithPrefix() {
+	for key, backend := range suite.StorageBackends {
+		prefixedBackend, ok := backend.(PrefixedBackend)
+		message := fmt.Sprintf("%s backend supports prefixes", key)
+		suite.True(ok, message)
+		if !ok {
+			continue
+		}
+		subBackend := prefixedBackend.WithPrefix("subrepo")
+		path := "nested.txt"
+		err := subBackend.PutObject(path, []byte("nested content"))
+		message = fmt.Sprintf("no error putting object %s at sub-prefix using %s backend", path, key)
+		suite.Nil(err, message)
+
+		objects, err := subBackend.ListObjects()
+		message = fmt.Sprintf("no error listing objects at sub-prefix using %s backend", key)
+		suite.Nil(err, message)
+		message = fmt.Sprintf("only object %s listed at sub-prefix using %s backend", path, key)
+		suite.Equal(1, len(objects), message)
+
+		objects, err = backend.ListObjects()
+		message = fmt.Sprintf("no error listing objects using %s backend", key)
+		suite.Nil(err, message)
+		for _, object := range objects {
+			message = fmt.Sprintf("object at sub-prefix not listed using %s backend", key)
+			suite.NotEqual(path, object.Path, message)
+		}
+
+		err = subBackend.DeleteObject(path)
+		message = fmt.Sprintf("no error deleting object %s at sub-prefix using %s backend", path, key)
+		suite.Nil(err, message)
+	}
+}
+
 func (suite *StorageTestSuite) TestHasSuffix() {
 	now := time.Now()
 	o1 := Object{
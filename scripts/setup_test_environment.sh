@@ -6,6 +6,16 @@ REQUIRED_TEST_ENV_VARS=(
     "TEST_STORAGE_AMAZON_REGION"
     "TEST_STORAGE_GOOGLE_BUCKET"
 )
+# microsoft storage is only tested against the cloud (make testcloud) or the emulator (make testazurite)
+if [ "$TEST_CLOUD_STORAGE" == "1" ]; then
+    REQUIRED_TEST_ENV_VARS+=(
+        "TEST_STORAGE_MICROSOFT_CONTAINER"
+        "TEST_STORAGE_MICROSOFT_ACCOUNT"
+        "TEST_STORAGE_MICROSOFT_ACCESS_KEY"
+    )
+elif [ "$TEST_STORAGE_MICROSOFT_EMULATOR" == "1" ]; then
+    REQUIRED_TEST_ENV_VARS+=("TEST_STORAGE_MICROSOFT_CONTAINER")
+fi
 
 DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )"
 cd $DIR/../